@@ -0,0 +1,34 @@
+package client
+
+import (
+	"os/exec"
+	"strings"
+
+	"kite/src/task/core"
+)
+
+//branchMeta 补全分支描述信息：负责人为当前用户，没有指定commit与ref时从工作区的git仓库读取
+func branchMeta(meta core.BranchMeta, work string) core.BranchMeta {
+	meta.Owner = core.NewOwner()
+	if len(work) == 0 {
+		work = "."
+	}
+	if len(meta.Commit) == 0 {
+		meta.Commit = git(work, "rev-parse", "HEAD")
+	}
+	if len(meta.Ref) == 0 {
+		if meta.Ref = git(work, "rev-parse", "--abbrev-ref", "HEAD"); meta.Ref == "HEAD" { //分离头指针时使用tag
+			meta.Ref = git(work, "describe", "--tags", "--exact-match")
+		}
+	}
+	return meta
+}
+
+//git 执行git命令；不是git仓库或者没有安装git时返回空
+func git(dir string, args ...string) string {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -2,44 +2,89 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 
 	_ "kite/src/task" //只加载不执行
 	"kite/src/task/core"
+	"kite/src/task/message"
 	"kite/src/util"
 )
 
-//Client 执行命令
-func Client(path, cmd, branch, work string, iscompress bool) {
+//result 命令的最终结果，json输出的最后一行
+type result struct {
+	Cmd     string       `json:"cmd"`
+	Branch  string       `json:"branch,omitempty"`
+	Success bool         `json:"success"`
+	Code    message.Code `json:"code"`            //失败的分类，同进程的退出码
+	Error   string       `json:"error,omitempty"` //失败的原因
+}
+
+//Client 执行命令，返回进程的退出码；output为json时stdout每行输出一个json：服务端的消息与最终结果
+func Client(path, cmd, branch, work, output string, iscompress bool, parallel int, force bool, meta core.BranchMeta, params url.Values, vars map[string]string) int {
+	var enc *json.Encoder
+	out := io.Writer(os.Stdout) //任务的输出与进度
+	switch output {
+	case "", "text":
+	case "json":
+		enc = json.NewEncoder(os.Stdout)
+		out = os.Stderr //进度等信息输出到stderr，stdout只输出json
+	default:
+		fmt.Printf("output:%s 不支持，可选：text、json\n", output)
+		return int(message.CodeConfig)
+	}
+	code, err := run(path, cmd, branch, work, iscompress, parallel, force, meta, params, vars, out, enc)
+	if enc != nil {
+		r := &result{Cmd: cmd, Branch: branch, Success: err == nil, Code: code}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		enc.Encode(r)
+	} else if err != nil {
+		fmt.Println(err)
+	}
+	return int(code)
+}
+
+//run 加载配置并执行任务
+func run(path, cmd, branch, work string, iscompress bool, parallel int, force bool, meta core.BranchMeta, params url.Values, vars map[string]string, out io.Writer, enc *json.Encoder) (message.Code, error) {
 	if len(path) == 0 {
 		path = util.GetCurrentPath()
 	}
 	cfgPath := path + "/task_client.json"
 	if !util.FileExists(cfgPath) {
-		fmt.Printf("配置文件:%s 不存在\n", cfgPath)
-		return
+		return message.CodeConfig, fmt.Errorf("配置文件:%s 不存在", cfgPath)
 	}
 	taskMap := core.NewMap()
 	err := core.Load(cfgPath, &taskMap)
 	if err != nil {
-		fmt.Printf("任务加载失败: %v\n", err)
-		return
+		return message.CodeConfig, fmt.Errorf("任务加载失败: %v", err)
 	}
 	taskList, ok := taskMap[cmd]
 	if !ok {
-		fmt.Printf("任务:%v不存在\n", cmd)
-		return
+		return message.CodeConfig, fmt.Errorf("任务:%v不存在", cmd)
 	}
-	session := core.NewSession(context.Background(), "root", os.Stdout, nil)
+	session := core.NewSession(context.Background(), "root", out, nil)
+	session.Log = out
 	session.TaskName = cmd
 	session.Branch = branch
 	session.WorkSpace = work
 	session.Compress = iscompress
+	session.Parallel = parallel
+	session.Holder = core.NewHolder()
+	session.Force = force
+	session.Meta = branchMeta(meta, work)
+	session.Params = params
+	session.Vars = vars
+	if enc != nil {
+		session.OnMessage = func(msg *message.Message) { enc.Encode(msg) }
+	}
 	err = taskList.Run(session)
 	if err != nil && err != io.EOF {
-		fmt.Printf("任务执行失败: %v\n", err)
-		return
+		return core.ErrorCode(err), fmt.Errorf("任务执行失败: %v", err)
 	}
+	return message.CodeOK, nil
 }
@@ -2,29 +2,81 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
 
 	"kite/src/client"
 	"kite/src/config"
 	"kite/src/server"
+	"kite/src/task/core"
 )
 
+//varFlag 可以重复的--var key=value
+type varFlag map[string]string
+
+func (v varFlag) String() string {
+	pairs := []string{}
+	for key, val := range v {
+		pairs = append(pairs, key+"="+val)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v varFlag) Set(s string) error {
+	key, val, ok := strings.Cut(s, "=")
+	if !ok || len(strings.TrimSpace(key)) == 0 {
+		return fmt.Errorf("格式错误，需要key=value")
+	}
+	v[strings.TrimSpace(key)] = val
+	return nil
+}
+
 func main() {
 	method := flag.String("func", "", `方法名称与路径
 	client: 启动客户端
-	server: 启动服务端`)
+	server: 启动服务端
+	migrate-store: 迁移分支信息的存储，args为"源存储 目标存储"，例如"file dir"`)
 	fpath := flag.String("path", "", "配置文件路径")
 	cmd := flag.String("cmd", "", `指令包含：
 	list: 获取分支列表
 	update: 更新分支
 	init: 创建分支
 	delete: 删除分支
-	unlock: 锁住测试环境`)
+	unlock: 解锁测试环境
+	locks: 查看锁的持有者
+	info: 查看分支的详细信息
+	extend: 延长分支的有效期
+	rollback: 回滚到之前的发布`)
 	branch := flag.String("b", "", "分支名称")
 	work := flag.String("workspace", "", "工作区")
 	args := flag.String("args", "", "参数")
 	compression := flag.Bool("compress", false, "是否压缩数据")
+	parallel := flag.Int("parallel", 0, "上传文件的连接数，默认使用配置")
+	force := flag.Bool("force", false, "强制释放其他人持有的锁")
+	commit := flag.String("commit", "", "源码的git commit，默认读取工作区的git仓库")
+	ref := flag.String("ref", "", "源码的git分支或者tag，默认读取工作区的git仓库")
+	desc := flag.String("desc", "", "分支的描述")
+	labels := flag.String("labels", "", "分支的标签，多个标签用逗号分隔")
+	to := flag.Int("to", 0, "回滚的目标版本(rollback命令)，默认上一个版本")
+	ttl := flag.Duration("ttl", 0, "分支的有效期(init、extend命令)，例如72h；默认使用服务端的配置，-1s表示不过期")
+	name := flag.String("name", "", "过滤分支名称的通配符(list命令)，例如feature-*")
+	owner := flag.String("owner", "", "过滤负责人(list命令)：user或者user@host")
+	label := flag.String("label", "", "过滤标签(list命令)，多个标签用逗号分隔，必须全部包含")
+	older := flag.Duration("older", 0, "过滤最后使用时间早于多久之前的分支(list命令)，例如72h")
+	sortKey := flag.String("sort", "", "排序字段(list命令)：name、version、time、created、used、size、owner；前缀-表示倒序")
+	format := flag.String("format", "", "输出格式(list命令)：table、json、csv，默认table")
+	output := flag.String("output", "text", `客户端的输出格式
+	text: 文本
+	json: 每行一个json，包含服务端的消息与最终的结果`)
+	vars := varFlag{}
+	flag.Var(vars, "var", "传给服务端任务的参数key=value，可以重复使用；服务端的ParamTask声明与校验，任务中使用${key}引用")
+	store := flag.String("store", "file", `分支信息的存储
+	file: 单个json文件(path/config.json)
+	dir: 每个分支一个文件(path/branches/)`)
 
 	flag.Parse()
 
@@ -38,9 +90,36 @@ func main() {
 		}
 		config.Set(params[0], params[1], "")
 	case "client":
-		client.Client(*fpath, *cmd, *branch, *work, *compression)
+		params := url.Values{}
+		if *to > 0 {
+			params.Set("to", strconv.Itoa(*to))
+		}
+		if *older > 0 {
+			params.Set("older", older.String())
+		}
+		for key, val := range map[string]string{"name": *name, "ownedby": *owner, "label": *label, "sort": *sortKey, "format": *format} {
+			if len(val) > 0 {
+				params.Set(key, val)
+			}
+		}
+		os.Exit(client.Client(*fpath, *cmd, *branch, *work, *output, *compression, *parallel, *force, core.BranchMeta{
+			Commit: *commit,
+			Ref:    *ref,
+			Desc:   *desc,
+			Labels: core.ParseLabels(*labels),
+			TTL:    int(ttl.Seconds()),
+		}, params, vars))
 	case "server":
-		server.Sev(*fpath, *work)
+		server.Sev(*fpath, *work, *store)
+	case "migrate-store":
+		params := strings.Split(*args, " ")
+		if len(params) < 2 {
+			log.Fatalf("参数格式错误")
+		}
+		if err := server.MigrateStore(*fpath, params[0], params[1]); err != nil {
+			fmt.Printf("迁移失败: %v\n", err)
+			os.Exit(1)
+		}
 	default:
 		log.Println("方法名称错误")
 	}
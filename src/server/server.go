@@ -13,7 +13,7 @@ import (
 )
 
 // Sev 服务入口
-func Sev(path, work string) {
+func Sev(path, work, store string) {
 	if len(path) == 0 {
 		path = util.GetCurrentPath()
 	}
@@ -28,7 +28,12 @@ func Sev(path, work string) {
 		fmt.Printf("任务加载失败: %v\n", err)
 		return
 	}
-	branchMan := core.NewBranchManager(path + "/config.json")
+	branchStore, err := core.NewBranchStore(store, path)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	branchMan := core.NewBranchManager(branchStore)
 	if branchMan == nil {
 		return
 	}
@@ -52,9 +57,30 @@ func Sev(path, work string) {
 	}
 }
 
+// MigrateStore 将分支信息从一种存储迁移到另一种存储；失败时返回错误，由调用者决定退出码
+func MigrateStore(path, from, to string) error {
+	if len(path) == 0 {
+		path = util.GetCurrentPath()
+	}
+	src, err := core.NewBranchStore(from, path)
+	if err != nil {
+		return err
+	}
+	dst, err := core.NewBranchStore(to, path)
+	if err != nil {
+		return err
+	}
+	n, err := core.MigrateStore(src, dst)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d个分支已经从%s迁移到%s\n", n, src, dst)
+	return nil
+}
+
 // listenSysSign 监听系统退出命令
 func listenSysSign() chan os.Signal {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	return c
 }
@@ -0,0 +1,45 @@
+package task
+
+import (
+	"fmt"
+
+	"kite/src/task/message"
+)
+
+//authOption 客户端签名的配置项
+type authOption struct {
+	KeyID  string //客户端的key id
+	Secret string //与服务端共享的密钥
+}
+
+//Init 数据初始化，所有字段都是选填
+func (a *authOption) Init(data map[string]interface{}) error {
+	var ok bool
+	if val, has := data["KeyID"]; has {
+		if a.KeyID, ok = val.(string); !ok {
+			return fmt.Errorf("KeyID type error")
+		}
+	}
+	if val, has := data["Secret"]; has {
+		if a.Secret, ok = val.(string); !ok {
+			return fmt.Errorf("Secret type error")
+		}
+	}
+	return nil
+}
+
+//toMap 将配置写入map
+func (a *authOption) toMap(data map[string]interface{}) {
+	if len(a.KeyID) > 0 {
+		data["KeyID"] = a.KeyID
+		data["Secret"] = a.Secret
+	}
+}
+
+//signer 获取签名器；没有配置KeyID时返回nil(不签名)
+func (a *authOption) signer() *message.Signer {
+	if len(a.KeyID) == 0 {
+		return nil
+	}
+	return &message.Signer{KeyID: a.KeyID, Secret: a.Secret}
+}
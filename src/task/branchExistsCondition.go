@@ -0,0 +1,59 @@
+package task
+
+import (
+	"fmt"
+
+	"kite/src/task/core"
+	"kite/src/util"
+)
+
+//BranchExistsCondition 分支是否存在的条件，只能在服务端使用
+type BranchExistsCondition struct {
+	Branch string //选填，分支名称，支持变量；默认当前分支
+}
+
+//检查是否实现IConditions接口
+var _ core.IConditions = (*BranchExistsCondition)(nil)
+
+func init() {
+	util.RegisterType((*BranchExistsCondition)(nil))
+}
+
+//Init 数据初始化
+func (c *BranchExistsCondition) Init(data map[string]interface{}) error {
+	if branch, ok := data["Branch"]; ok {
+		if c.Branch, ok = branch.(string); !ok {
+			return fmt.Errorf("BranchExistsCondition Branch type error")
+		}
+	}
+	return nil
+}
+
+//ToMap 数据转换为map
+func (c *BranchExistsCondition) ToMap() map[string]interface{} {
+	data := make(map[string]interface{})
+	data["Branch"] = c.Branch
+	return data
+}
+
+//Eval 检查分支，满足时返回true
+func (c *BranchExistsCondition) Eval(session *core.Session) (bool, error) {
+	if session.BMan == nil {
+		return false, fmt.Errorf("BranchExistsCondition 只能在服务端使用")
+	}
+	branch := session.Branch
+	if len(c.Branch) > 0 {
+		var err error
+		if branch, err = session.Expand(c.Branch); err != nil {
+			return false, err
+		}
+	}
+	_, ok := session.BMan.GetBranch(branch)
+	return ok, nil
+}
+
+//Run 单独执行时只计算条件，结果由IfElse等通过Eval获取
+func (c *BranchExistsCondition) Run(session *core.Session) error {
+	_, err := c.Eval(session)
+	return err
+}
@@ -0,0 +1,137 @@
+package task
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"kite/src/task/core"
+	"kite/src/util"
+)
+
+//changeSet 分支最后一次上传修改(包括mirror删除)的文件
+type changeSet struct {
+	version int             //上传对应的分支版本：当前版本+1
+	files   map[string]bool //相对分支目录的路径，使用/分隔
+}
+
+//changeRegistry 所有分支最后一次上传修改的文件，只保存在内存中，服务重启之后清空
+type changeRegistry struct {
+	mu    sync.Mutex
+	items map[string]*changeSet //分支 => 修改的文件
+}
+
+//uploadChanges 所有分支最后一次上传修改的文件
+var uploadChanges = &changeRegistry{items: make(map[string]*changeSet)}
+
+//add 记录上传修改的文件；新的一次上传(分支版本变化)时清空之前的记录
+func (r *changeRegistry) add(session *core.Session, file string) {
+	version := 1
+	if b, ok := session.GetCurBranchEntity(); ok {
+		version = b.Version + 1
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	set, ok := r.items[session.Branch]
+	if !ok || set.version != version {
+		set = &changeSet{version: version, files: make(map[string]bool)}
+		r.items[session.Branch] = set
+	}
+	set.files[file] = true
+}
+
+//list 分支最后一次上传修改的文件，按路径排序；只返回还没有发布的上传，或者本次命令(${version})发布的上传
+func (r *changeRegistry) list(session *core.Session) []string {
+	pending := 1
+	if b, ok := session.GetCurBranchEntity(); ok {
+		pending = b.Version + 1
+	}
+	published, _ := session.Var("version")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	files := []string{}
+	if set, ok := r.items[session.Branch]; ok && (set.version == pending || strconv.Itoa(set.version) == published) {
+		for file := range set.files {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+//ChangedCondition 最后一次上传修改的文件是否匹配通配符的条件，只能在服务端使用；
+//修改的文件保存到变量${changedFiles}(逗号分隔)
+type ChangedCondition struct {
+	Patterns []string //通配符，例如composer.*、config/*.php；不包含/时匹配文件名
+}
+
+//检查是否实现IConditions接口
+var _ core.IConditions = (*ChangedCondition)(nil)
+
+func init() {
+	util.RegisterType((*ChangedCondition)(nil))
+}
+
+//Init 数据初始化
+func (c *ChangedCondition) Init(data map[string]interface{}) error {
+	list, ok := data["Patterns"].([]interface{})
+	if !ok || len(list) == 0 {
+		return fmt.Errorf("ChangedCondition Patterns type error")
+	}
+	for _, item := range list {
+		pattern, ok := item.(string)
+		if !ok {
+			return fmt.Errorf("ChangedCondition Patterns type error")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("ChangedCondition Patterns:%s err:%v", pattern, err)
+		}
+		c.Patterns = append(c.Patterns, pattern)
+	}
+	return nil
+}
+
+//ToMap 数据转换为map
+func (c *ChangedCondition) ToMap() map[string]interface{} {
+	data := make(map[string]interface{})
+	data["Patterns"] = c.Patterns
+	return data
+}
+
+//Eval 检查修改的文件，满足时返回true
+func (c *ChangedCondition) Eval(session *core.Session) (bool, error) {
+	if session.BMan == nil {
+		return false, fmt.Errorf("ChangedCondition 只能在服务端使用")
+	}
+	files := uploadChanges.list(session)
+	session.SetVar("changedFiles", strings.Join(files, ","))
+	for _, file := range files {
+		if c.match(file) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//match 文件是否匹配任意一个通配符
+func (c *ChangedCondition) match(file string) bool {
+	for _, pattern := range c.Patterns {
+		name := file
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(file)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//Run 单独执行时只计算条件，结果由IfElse等通过Eval获取
+func (c *ChangedCondition) Run(session *core.Session) error {
+	_, err := c.Eval(session)
+	return err
+}
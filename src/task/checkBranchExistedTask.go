@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"kite/src/task/core"
+	"kite/src/task/message"
 	"kite/src/util"
 )
 
@@ -34,5 +35,5 @@ func (c *CheckBranchExistedTask) Run(session *core.Session) error {
 	if ok {
 		return nil
 	}
-	return fmt.Errorf("branch:%s not exists", session.Branch)
+	return core.WithCode(message.CodeNotExist, fmt.Errorf("branch:%s not exists", session.Branch))
 }
@@ -13,7 +13,6 @@ import (
 type ContainsTask struct {
 	FilePath  string
 	SubString string
-	result    bool
 }
 
 //检查是否实现IConditions接口
@@ -43,21 +42,25 @@ func (c *ContainsTask) ToMap() map[string]interface{} {
 	return data
 }
 
-//Run 创建分支
+//Run 单独执行时只计算条件，结果由IfElse等通过Eval获取
 func (c *ContainsTask) Run(session *core.Session) error {
-	data, err := ioutil.ReadFile(c.FilePath)
-	if err != nil {
-		return err
-	}
-	substr := session.ReplaceEnvVar(c.SubString)
-	c.result = strings.Contains(string(data), substr)
-	return nil
+	_, err := c.Eval(session)
+	return err
 }
 
-// GetResult 获取条件的执行结果
-func (c *ContainsTask) GetResult() int {
-	if c.result {
-		return 1
+//Eval 检查文件是否包含字符串，包含时返回true
+func (c *ContainsTask) Eval(session *core.Session) (bool, error) {
+	path, err := session.Expand(c.FilePath)
+	if err != nil {
+		return false, err
+	}
+	substr, err := session.Expand(c.SubString)
+	if err != nil {
+		return false, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
 	}
-	return 0
+	return strings.Contains(string(data), substr), nil
 }
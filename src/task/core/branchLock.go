@@ -0,0 +1,277 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kite/src/task/message"
+)
+
+//GlobalLock 全局锁的名称；持有全局锁时其他人不能获取任何分支锁，其他人锁住任何分支时也不能获取全局锁
+const GlobalLock = ""
+
+//Lease 锁的租约；持有者执行命令时自动续期，超过有效期没有续期自动释放
+type Lease struct {
+	Branch   string        //分支，GlobalLock表示全局锁
+	Holder   string        //持有者：user@host/会话id/服务端校验的身份(见BindHolder)
+	Cmd      string        //持有者正在执行的命令；空表示没有执行命令
+	Acquired time.Time     //获取锁的时间
+	Renewed  time.Time     //最后续期的时间
+	TTL      time.Duration //有效期；0表示不过期
+}
+
+//Expired 租约是否已经过期
+func (l *Lease) Expired(now time.Time) bool {
+	return l.TTL > 0 && now.Sub(l.Renewed) > l.TTL
+}
+
+//String 将数据转换为字符串
+func (l *Lease) String() string {
+	name := l.Branch
+	if name == GlobalLock {
+		name = "全局"
+	}
+	return fmt.Sprintf("%s锁被%s持有(%s前获取)", name, HolderName(l.Holder), time.Since(l.Acquired).Round(time.Second))
+}
+
+//lockWaiter 排队等待锁的请求
+type lockWaiter struct {
+	seq    int64  //排队的序号，越小越先获取锁
+	holder string //持有者
+}
+
+//branchLocks 每个分支一个锁，不同分支之间互不影响
+type branchLocks struct {
+	mu      sync.Mutex
+	leases  map[string]*Lease        //分支 => 租约
+	queues  map[string][]*lockWaiter //分支 => 排队等待锁的请求(先进先出)
+	seq     int64                    //排队的序号
+	changed chan struct{}            //锁释放或者排队变化时关闭，通知所有等待者
+}
+
+//conflict 获取其他人持有的、与分支冲突的租约(调用方持有mu)
+func (b *branchLocks) conflict(branch, holder string) *Lease {
+	b.purge()
+	for name, lease := range b.leases {
+		if lease.Holder != holder && (name == branch || name == GlobalLock || branch == GlobalLock) {
+			return lease
+		}
+	}
+	return nil
+}
+
+//purge 释放所有过期的锁(调用方持有mu)
+func (b *branchLocks) purge() {
+	now := time.Now()
+	for name, lease := range b.leases {
+		if lease.Expired(now) {
+			log.Printf("lock:%q held by:%s expired\n", name, lease.Holder)
+			delete(b.leases, name)
+			b.notify()
+		}
+	}
+}
+
+//ahead 排在等待者前面、与分支冲突的请求数量；w为空时返回所有冲突的请求数量(调用方持有mu)
+func (b *branchLocks) ahead(branch string, w *lockWaiter) int {
+	n := 0
+	for name, queue := range b.queues {
+		if name != branch && name != GlobalLock && branch != GlobalLock {
+			continue
+		}
+		for _, other := range queue {
+			if w == nil || other.seq < w.seq {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+//acquire 获取锁；已经持有时续期(调用方持有mu)
+func (b *branchLocks) acquire(branch, holder string, ttl time.Duration) {
+	if b.leases == nil {
+		b.leases = make(map[string]*Lease)
+	}
+	now := time.Now()
+	if lease, ok := b.leases[branch]; ok { //重复获取，续期
+		lease.Renewed = now
+		lease.TTL = ttl
+		return
+	}
+	b.leases[branch] = &Lease{Branch: branch, Holder: holder, Acquired: now, Renewed: now, TTL: ttl}
+}
+
+//notify 通知所有等待者(调用方持有mu)
+func (b *branchLocks) notify() {
+	if b.changed != nil {
+		close(b.changed)
+	}
+	b.changed = make(chan struct{})
+}
+
+//TryLock 尝试获取分支的锁；branch为GlobalLock时获取全局锁；已经持有时续期；有其他人排队时不能获取
+func (c *BranchManager) TryLock(branch, holder string, ttl time.Duration) error {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	if lease := c.lock.conflict(branch, holder); lease != nil {
+		return WithCode(message.CodeLocked, fmt.Errorf("%s", lease))
+	}
+	if lease, ok := c.lock.leases[branch]; !ok || lease.Holder != holder {
+		if n := c.lock.ahead(branch, nil); n > 0 {
+			return WithCode(message.CodeLocked, fmt.Errorf("%d个请求正在排队等待锁", n))
+		}
+	}
+	c.lock.acquire(branch, holder, ttl)
+	return nil
+}
+
+//WaitLock 排队等待分支的锁，同一个分支(或全局)的请求先进先出；
+//排队期间每次检查都调用position(前面的请求数量)，返回错误时停止等待
+func (c *BranchManager) WaitLock(ctx context.Context, branch, holder string, ttl time.Duration, position func(int) error) error {
+	c.lock.mu.Lock()
+	if c.lock.queues == nil {
+		c.lock.queues = make(map[string][]*lockWaiter)
+	}
+	c.lock.seq++
+	w := &lockWaiter{seq: c.lock.seq, holder: holder}
+	c.lock.queues[branch] = append(c.lock.queues[branch], w)
+	c.lock.mu.Unlock()
+	defer c.dequeue(branch, w)
+	ticker := time.NewTicker(time.Second) //锁过期不会通知，定时检查
+	defer ticker.Stop()
+	for {
+		c.lock.mu.Lock()
+		n := c.lock.ahead(branch, w)
+		if n == 0 && c.lock.conflict(branch, holder) == nil {
+			c.lock.acquire(branch, holder, ttl)
+			c.lock.mu.Unlock()
+			return nil
+		}
+		if c.lock.changed == nil {
+			c.lock.changed = make(chan struct{})
+		}
+		changed := c.lock.changed
+		c.lock.mu.Unlock()
+		if err := position(n); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+//dequeue 从排队中移除等待者
+func (c *BranchManager) dequeue(branch string, w *lockWaiter) {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	queue := c.lock.queues[branch]
+	for i, other := range queue {
+		if other == w {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(c.lock.queues, branch)
+	} else {
+		c.lock.queues[branch] = queue
+	}
+	c.lock.notify()
+}
+
+//Renew 续期持有者在分支与全局的锁，并记录正在执行的命令
+func (c *BranchManager) Renew(branch, holder, cmd string) {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	now := time.Now()
+	for _, name := range []string{branch, GlobalLock} {
+		if lease, ok := c.lock.leases[name]; ok && lease.Holder == holder && !lease.Expired(now) {
+			lease.Renewed = now
+			lease.Cmd = cmd
+		}
+	}
+}
+
+//Leases 获取所有没有过期的锁，按分支排序
+func (c *BranchManager) Leases() []Lease {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	c.lock.purge()
+	leases := make([]Lease, 0, len(c.lock.leases))
+	for _, lease := range c.lock.leases {
+		leases = append(leases, *lease)
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].Branch < leases[j].Branch })
+	return leases
+}
+
+//Unlock 释放分支的锁；只有持有者可以释放，force为true时强制释放
+func (c *BranchManager) Unlock(branch, holder string, force bool) error {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	lease, ok := c.lock.leases[branch]
+	if !ok || lease.Expired(time.Now()) {
+		delete(c.lock.leases, branch)
+		return nil
+	}
+	if lease.Holder != holder && !force {
+		return WithCode(message.CodeLocked, fmt.Errorf("%s，只有持有者可以释放，或者使用--force强制释放", lease))
+	}
+	if lease.Holder != holder {
+		log.Printf("lock:%q held by:%s force released by:%s\n", branch, lease.Holder, holder)
+	}
+	delete(c.lock.leases, branch)
+	c.lock.notify()
+	return nil
+}
+
+//IsLocked 分支是否被锁住(包括全局锁)
+func (c *BranchManager) IsLocked(branch string) bool {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	return c.lock.conflict(branch, "") != nil
+}
+
+//NewHolder 生成锁的持有者标识：user@host/会话id
+func NewHolder() string {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return fmt.Sprintf("%s/%x", NewOwner(), id)
+}
+
+//BindHolder 服务端将客户端传入的持有者与校验过的身份(签名的key、客户端证书)绑定；
+//其他身份即使传入相同的持有者也不能释放锁。identity为空(没有启用签名与双向认证)时不绑定
+func BindHolder(holder, identity string) string {
+	if len(identity) == 0 {
+		return holder
+	}
+	return holder + "/" + identity
+}
+
+//HolderName 持有者中的user@host，用于展示；不展示会话id与身份，避免被复制之后释放别人的锁
+func HolderName(holder string) string {
+	return strings.SplitN(holder, "/", 2)[0]
+}
+
+//NewOwner 生成当前用户的标识：user@host
+func NewOwner() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
@@ -1,15 +1,17 @@
 package core
 
 import (
-	"encoding/json"
-	"io/ioutil"
+	"fmt"
 	"log"
-	"os"
+	"sync"
 	"time"
 
-	"kite/src/util"
+	"kite/src/task/message"
 )
 
+//TimeLayout 分支信息中时间的格式
+const TimeLayout = "2006-01-02 15:04:05"
+
 // Branch 分支信息
 type Branch struct {
 	// Name 分支名称
@@ -18,108 +20,222 @@ type Branch struct {
 	Path string `json:"path"`
 	// Version 版本号
 	Version int `json:"version"`
+	// Release 当前发布的版本(current指向releases/<Release>)；0表示没有启用发布目录
+	Release int `json:"release,omitempty"`
 	// Time 最后更新时间
 	Time string `json:"time"`
+	// Created 创建时间
+	Created string `json:"created,omitempty"`
+	// LastUsed 最后使用时间(创建、更新、延期)，超过有效期没有使用自动删除
+	LastUsed string `json:"lastUsed,omitempty"`
+	// BranchMeta 客户端提交的分支描述信息
+	BranchMeta
+	// LastResult 最后一次命令的执行结果
+	LastResult *CmdResult `json:"lastResult,omitempty"`
+}
+
+//ExpireAt 过期时间；有效期<=0时不过期
+func (b *Branch) ExpireAt() (time.Time, bool) {
+	if b.TTL <= 0 {
+		return time.Time{}, false
+	}
+	last := b.LastUsed
+	if len(last) == 0 { //旧的分支没有最后使用时间
+		last = b.Time
+	}
+	t, err := time.ParseInLocation(TimeLayout, last, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t.Add(time.Duration(b.TTL) * time.Second), true
+}
+
+//Expired 分支是否已经过期
+func (b *Branch) Expired(now time.Time) bool {
+	at, ok := b.ExpireAt()
+	return ok && now.After(at)
+}
+
+//clone 复制分支信息
+func (b *Branch) clone() *Branch {
+	cp := *b
+	cp.Labels = append([]string(nil), b.Labels...)
+	if b.LastResult != nil {
+		result := *b.LastResult
+		cp.LastResult = &result
+	}
+	return &cp
 }
 
 // BranchManager 分支管理
 type BranchManager struct {
 	// List 分支信息
 	list []*Branch
-	// Path 保存路径
-	Path string
-	// 自旋锁
-	util.SpinLock
+	// Store 分支信息的存储
+	Store BranchStore
+	// 保护分支信息：读取时共享，修改与保存时独占
+	mu sync.RWMutex
+	// 分支锁
+	lock branchLocks
 }
 
-// Save 保存配置
-func (c *BranchManager) Save() error {
-	data, err := json.Marshal(c.list)
-	if err != nil {
-		log.Fatalf("配置文件序列化失败：%v", err)
+// BranchTx 修改分支信息的事务；在分支信息的副本上修改，保存成功之后才生效
+type BranchTx struct {
+	list []*Branch
+}
+
+// GetBranch 获取分支，修改之后随事务一起保存
+func (tx *BranchTx) GetBranch(name string) (*Branch, bool) {
+	for _, item := range tx.list {
+		if item.Name == name {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+//Len 分支的数量
+func (tx *BranchTx) Len() int {
+	return len(tx.list)
+}
+
+//AddBranch 添加分支
+func (tx *BranchTx) AddBranch(name, path string) {
+	now := time.Now().Format(TimeLayout)
+	tx.list = append(tx.list, &Branch{
+		Name:     name,
+		Version:  1,
+		Time:     now,
+		Created:  now,
+		LastUsed: now,
+		Path:     path,
+	})
+}
+
+//DelBranch 删除分支
+func (tx *BranchTx) DelBranch(name string) {
+	if len(name) <= 0 {
+		return
+	}
+	list := make([]*Branch, 0, len(tx.list))
+	for _, item := range tx.list {
+		if item.Name != name {
+			list = append(list, item)
+		}
+	}
+	tx.list = list
+}
+
+// Tx 执行事务：f返回错误或者保存失败时，所有的修改都不生效
+func (c *BranchManager) Tx(f func(tx *BranchTx) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tx := &BranchTx{list: copyBranches(c.list)}
+	if err := f(tx); err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(c.Path, data, os.ModePerm)
-	if err != nil {
-		log.Fatalf("配置文件保存失败：%v", err)
+	if err := c.Store.Save(tx.list); err != nil {
+		return err
 	}
-	return err
+	c.list = tx.list
+	return nil
+}
+
+// Save 保存配置
+func (c *BranchManager) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Store.Save(c.list)
 }
 
 // Load 加载配置
 func (c *BranchManager) Load() error {
-	content, err := ioutil.ReadFile(c.Path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list, err := c.Store.Load()
 	if err != nil {
-		log.Fatalf("配置文件:%s 加载失败:\n%v", c.Path, err)
+		log.Printf("%s 加载失败:%v", c.Store, err)
 		return err
 	}
-	if len(content) > 0 {
-		err = json.Unmarshal(content, &c.list)
-		if err != nil {
-			log.Fatalf("配置文件解析失败: %v", err)
-			return err
-		}
-	}
+	c.list = list
 	return nil
 }
 
-// GetBranch 获取分支
+// GetBranch 获取分支(副本)；修改分支需要使用UpdateBranch或者Tx
 func (c *BranchManager) GetBranch(name string) (*Branch, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	for _, item := range c.list {
 		if item.Name == name {
-			return item, true
+			return item.clone(), true
 		}
 	}
 	return nil, false
 }
 
-//DelBranch 删除分支
-func (c *BranchManager) DelBranch(name string) {
-	if len(name) <= 0 {
-		return
-	}
-	list := make([]*Branch, 0, len(c.list)-1)
-	for _, item := range c.list {
-		if item.Name != name {
-			list = append(list, item)
-		}
-	}
-	c.list = list
+//DelBranch 删除分支并保存
+func (c *BranchManager) DelBranch(name string) error {
+	return c.Tx(func(tx *BranchTx) error {
+		tx.DelBranch(name)
+		return nil
+	})
 }
 
-//AddBranch 添加分支
-func (c *BranchManager) AddBranch(name, path string) {
-	c.list = append(c.list, &Branch{
-		Name:    name,
-		Version: 1,
-		Time:    time.Now().Format("2006-01-02 15:04:05"),
-		Path:    path,
+//AddBranch 添加分支并保存
+func (c *BranchManager) AddBranch(name, path string) error {
+	return c.Tx(func(tx *BranchTx) error {
+		tx.AddBranch(name, path)
+		return nil
 	})
 }
 
-//Foreach 遍历所有的分支
+//UpdateBranch 修改分支并保存
+func (c *BranchManager) UpdateBranch(name string, f func(*Branch)) error {
+	return c.Tx(func(tx *BranchTx) error {
+		b, ok := tx.GetBranch(name)
+		if !ok {
+			return WithCode(message.CodeNotExist, fmt.Errorf("branch:%s not exist", name))
+		}
+		f(b)
+		return nil
+	})
+}
+
+//Foreach 遍历所有的分支(副本)
 func (c *BranchManager) Foreach(f func(*Branch, int) bool) {
-	for i, item := range c.list {
+	for i, item := range c.Filter(func(*Branch, int) bool { return true }) {
 		if !f(item, i) {
 			break
 		}
 	}
 }
 
-//Filter 过滤分支
+//Filter 过滤分支(副本)
 func (c *BranchManager) Filter(f func(*Branch, int) bool) []*Branch {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	list := []*Branch{}
 	for i, item := range c.list {
-		if f(item, i) {
-			list = append(list, item)
+		b := item.clone()
+		if f(b, i) {
+			list = append(list, b)
 		}
 	}
 	return list
 }
 
+//copyBranches 复制分支信息
+func copyBranches(list []*Branch) []*Branch {
+	cp := make([]*Branch, 0, len(list))
+	for _, item := range list {
+		cp = append(cp, item.clone())
+	}
+	return cp
+}
+
 //NewBranchManager 创建一个分支管理者
-func NewBranchManager(path string) *BranchManager {
-	ctx := &BranchManager{Path: path}
+func NewBranchManager(store BranchStore) *BranchManager {
+	ctx := &BranchManager{Store: store}
 	err := ctx.Load()
 	if err != nil {
 		return nil
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//BranchMeta 客户端提交的分支描述信息
+type BranchMeta struct {
+	Owner  string   `json:"owner,omitempty"`  //负责人：user@host
+	Commit string   `json:"commit,omitempty"` //源码的git commit
+	Ref    string   `json:"ref,omitempty"`    //源码的git分支或者tag
+	Desc   string   `json:"desc,omitempty"`   //描述
+	Labels []string `json:"labels,omitempty"` //标签
+	TTL    int      `json:"ttl,omitempty"`    //有效期(单位：s)，超过有效期没有使用自动删除；<=0表示不过期
+}
+
+//CmdResult 命令的执行结果
+type CmdResult struct {
+	Cmd     string `json:"cmd"`               //命令
+	Success bool   `json:"success"`           //是否成功
+	Message string `json:"message,omitempty"` //失败的原因
+	Time    string `json:"time"`              //执行时间
+}
+
+//NewCmdResult 创建命令的执行结果
+func NewCmdResult(cmd string, err error) *CmdResult {
+	result := &CmdResult{Cmd: cmd, Success: err == nil, Time: time.Now().Format(TimeLayout)}
+	if err != nil {
+		result.Message = err.Error()
+	}
+	return result
+}
+
+//Params 转换为请求参数；空的字段不发送
+func (m *BranchMeta) Params(params url.Values) {
+	for key, val := range map[string]string{
+		"owner":  m.Owner,
+		"commit": m.Commit,
+		"ref":    m.Ref,
+		"desc":   m.Desc,
+		"labels": strings.Join(m.Labels, ","),
+	} {
+		if len(val) > 0 {
+			params.Set(key, val)
+		}
+	}
+	if m.TTL != 0 {
+		params.Set("ttl", strconv.Itoa(m.TTL))
+	}
+}
+
+//ParseBranchMeta 从请求参数中解析分支描述信息
+func ParseBranchMeta(get func(string) string) BranchMeta {
+	ttl, _ := strconv.Atoi(get("ttl"))
+	return BranchMeta{
+		Owner:  get("owner"),
+		Commit: get("commit"),
+		Ref:    get("ref"),
+		Desc:   get("desc"),
+		Labels: ParseLabels(get("labels")),
+		TTL:    ttl,
+	}
+}
+
+//ParseLabels 解析逗号分隔的标签，去掉空白与重复的标签并排序
+func ParseLabels(s string) []string {
+	set := make(map[string]bool)
+	labels := []string{}
+	for _, label := range strings.Split(s, ",") {
+		label = strings.TrimSpace(label)
+		if len(label) > 0 && !set[label] {
+			set[label] = true
+			labels = append(labels, label)
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+//Merge 合并客户端提交的信息；客户端没有提交的字段保留原来的值
+func (m *BranchMeta) Merge(other BranchMeta) {
+	if len(other.Owner) > 0 && len(m.Owner) == 0 { //负责人只在创建时记录
+		m.Owner = other.Owner
+	}
+	if len(other.Commit) > 0 {
+		m.Commit = other.Commit
+	}
+	if len(other.Ref) > 0 {
+		m.Ref = other.Ref
+	}
+	if len(other.Desc) > 0 {
+		m.Desc = other.Desc
+	}
+	if len(other.Labels) > 0 {
+		m.Labels = append([]string(nil), other.Labels...)
+	}
+	if other.TTL != 0 {
+		m.TTL = other.TTL
+	}
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+//BranchStore 分支信息的存储
+type BranchStore interface {
+	//Load 加载所有的分支
+	Load() ([]*Branch, error)
+	//Save 保存所有的分支；必须是原子的，失败时已经保存的分支信息不变
+	Save(list []*Branch) error
+	//String 存储的描述
+	String() string
+}
+
+//NewBranchStore 根据类型创建存储：file 单个json文件(path/config.json)；dir 每个分支一个文件(path/branches/)
+func NewBranchStore(kind, path string) (BranchStore, error) {
+	switch kind {
+	case "", "file":
+		return NewFileStore(filepath.Join(path, "config.json")), nil
+	case "dir":
+		return NewDirStore(filepath.Join(path, "branches")), nil
+	}
+	return nil, fmt.Errorf("store:%s not support(file、dir)", kind)
+}
+
+//MigrateStore 将分支信息从一个存储复制到另一个存储；目标存储已经有分支时失败，目标文件不存在时按空的存储处理
+func MigrateStore(from, to BranchStore) (int, error) {
+	list, err := from.Load()
+	if err != nil {
+		return 0, err
+	}
+	exists, err := to.Load()
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if len(exists) > 0 {
+		return 0, fmt.Errorf("%s 已经有%d个分支", to, len(exists))
+	}
+	return len(list), to.Save(list)
+}
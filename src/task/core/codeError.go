@@ -0,0 +1,57 @@
+package core
+
+import (
+	"errors"
+	"net"
+
+	"kite/src/task/message"
+)
+
+//CodeError 带有失败分类的错误，服务端把分类发送给客户端，客户端作为进程的退出码
+type CodeError struct {
+	Code message.Code //失败的分类
+	Err  error        //原始的错误
+}
+
+//Error 错误信息
+func (e *CodeError) Error() string {
+	return e.Err.Error()
+}
+
+//Unwrap 原始的错误
+func (e *CodeError) Unwrap() error {
+	return e.Err
+}
+
+//WithCode 给错误加上失败的分类
+func WithCode(code message.Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &CodeError{Code: code, Err: err}
+}
+
+//ErrorCode 获取错误的分类；网络错误属于连接失败，没有分类的错误属于任务执行失败
+func ErrorCode(err error) message.Code {
+	if err == nil {
+		return message.CodeOK
+	}
+	var ce *CodeError
+	if errors.As(err, &ce) {
+		return ce.Code
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return message.CodeConn
+	}
+	return message.CodeFail
+}
+
+//MessageError 服务端返回的失败消息转换为错误；旧的服务端没有分类时属于任务执行失败
+func MessageError(msg *message.Message) error {
+	code := msg.Code
+	if code == message.CodeOK {
+		code = message.CodeFail
+	}
+	return &CodeError{Code: code, Err: errors.New(msg.Content)}
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//CompareOps 支持的比较运算符
+var CompareOps = []string{"==", "!=", "=~", "!~", ">=", "<=", ">", "<"}
+
+//Compare 比较两个值：==、!=按字符串比较；=~、!~匹配正则表达式right；
+//>、<、>=、<=两边都是数字时按数字比较，否则按字符串比较
+func Compare(left, op, right string) (bool, error) {
+	switch op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	case "=~", "!~":
+		reg, err := regexp.Compile(right)
+		if err != nil {
+			return false, fmt.Errorf("正则表达式:%s 错误:%v", right, err)
+		}
+		return reg.MatchString(left) == (op == "=~"), nil
+	}
+	cmp := strings.Compare(left, right)
+	l, lerr := strconv.ParseFloat(left, 64)
+	r, rerr := strconv.ParseFloat(right, 64)
+	if lerr == nil && rerr == nil {
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		default:
+			cmp = 0
+		}
+	}
+	switch op {
+	case ">":
+		return cmp > 0, nil
+	case "<":
+		return cmp < 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	}
+	return false, fmt.Errorf("运算符:%s 不支持，可选：==、!=、=~、!~、>、<、>=、<=", op)
+}
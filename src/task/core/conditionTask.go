@@ -0,0 +1,173 @@
+package core
+
+import (
+	"fmt"
+
+	"kite/src/util"
+)
+
+//检查是否实现IConditions接口
+var (
+	_ IConditions = (*AndCondition)(nil)
+	_ IConditions = (*OrCondition)(nil)
+	_ IConditions = (*NotCondition)(nil)
+)
+
+func init() {
+	util.RegisterType((*AndCondition)(nil))
+	util.RegisterType((*OrCondition)(nil))
+	util.RegisterType((*NotCondition)(nil))
+}
+
+//condWithMap 根据map创建条件
+func condWithMap(typ string, data interface{}) (IConditions, error) {
+	val, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s Cond type error", typ)
+	}
+	nt, err := TaskWithMap(val)
+	if err != nil {
+		return nil, err
+	}
+	cond, ok := nt.Task.(IConditions)
+	if !ok {
+		return nil, fmt.Errorf("%s Cond type err: cant convert (%T) to (%T)", typ, nt.Task, IConditions(nil))
+	}
+	return cond, nil
+}
+
+//condsWithArray 根据数组创建条件列表
+func condsWithArray(typ string, data map[string]interface{}) ([]IConditions, error) {
+	list, ok := data["Conds"].([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("%s Conds type error", typ)
+	}
+	conds := make([]IConditions, 0, len(list))
+	for _, item := range list {
+		cond, err := condWithMap(typ, item)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+	}
+	return conds, nil
+}
+
+//condsToArray 条件列表转换为数组
+func condsToArray(conds []IConditions) []interface{} {
+	data := make([]interface{}, 0, len(conds))
+	for _, cond := range conds {
+		item := cond.ToMap()
+		item[TypeKey] = util.TypeName(cond)
+		data = append(data, item)
+	}
+	return data
+}
+
+//evalConds 依次执行条件；有一个条件的结果等于expect时停止执行之后的条件并返回true
+func evalConds(session *Session, conds []IConditions, expect bool) (bool, error) {
+	for _, cond := range conds {
+		ok, err := cond.Eval(session)
+		if err != nil {
+			return false, err
+		}
+		if ok == expect {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//AndCondition 所有条件都满足(结果不为0)时结果为1，否则为0
+type AndCondition struct {
+	Conds []IConditions //条件列表
+}
+
+//Init 初始化任务
+func (c *AndCondition) Init(data map[string]interface{}) (err error) {
+	c.Conds, err = condsWithArray("AndCondition", data)
+	return err
+}
+
+//ToMap 数据转换为map
+func (c *AndCondition) ToMap() map[string]interface{} {
+	return map[string]interface{}{"Conds": condsToArray(c.Conds)}
+}
+
+//Run 单独执行时只计算条件
+func (c *AndCondition) Run(session *Session) error {
+	_, err := c.Eval(session)
+	return err
+}
+
+//Eval 依次执行条件，有一个不满足时停止
+func (c *AndCondition) Eval(session *Session) (bool, error) {
+	failed, err := evalConds(session, c.Conds, false)
+	return !failed && err == nil, err
+}
+
+//OrCondition 有一个条件满足(结果不为0)时结果为1，否则为0
+type OrCondition struct {
+	Conds []IConditions //条件列表
+}
+
+//Init 初始化任务
+func (c *OrCondition) Init(data map[string]interface{}) (err error) {
+	c.Conds, err = condsWithArray("OrCondition", data)
+	return err
+}
+
+//ToMap 数据转换为map
+func (c *OrCondition) ToMap() map[string]interface{} {
+	return map[string]interface{}{"Conds": condsToArray(c.Conds)}
+}
+
+//Run 单独执行时只计算条件
+func (c *OrCondition) Run(session *Session) error {
+	_, err := c.Eval(session)
+	return err
+}
+
+//Eval 依次执行条件，有一个满足时停止
+func (c *OrCondition) Eval(session *Session) (bool, error) {
+	return evalConds(session, c.Conds, true)
+}
+
+//NotCondition 条件不满足(结果为0)时结果为1，否则为0
+type NotCondition struct {
+	Cond IConditions //条件
+}
+
+//Init 初始化任务
+func (c *NotCondition) Init(data map[string]interface{}) (err error) {
+	c.Cond, err = condWithMap("NotCondition", data["Cond"])
+	return err
+}
+
+//ToMap 数据转换为map
+func (c *NotCondition) ToMap() map[string]interface{} {
+	return map[string]interface{}{"Cond": condsToArray([]IConditions{c.Cond})[0]}
+}
+
+//Run 单独执行时只计算条件
+func (c *NotCondition) Run(session *Session) error {
+	_, err := c.Eval(session)
+	return err
+}
+
+//Eval 执行条件，不满足时返回true
+func (c *NotCondition) Eval(session *Session) (bool, error) {
+	ok, err := c.Cond.Eval(session)
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
+
+//boolResult 条件的结果转换为1或0
+func boolResult(ok bool) int {
+	if ok {
+		return 1
+	}
+	return 0
+}
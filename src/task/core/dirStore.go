@@ -0,0 +1,195 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"kite/src/util"
+)
+
+const (
+	//branchSuffix 分支文件的后缀；上一个版本保存为.json.bak
+	branchSuffix = ".json"
+	//stageSuffix 保存时写入的临时文件的后缀，全部写入之后再替换分支文件
+	stageSuffix = ".new"
+	//removeSuffix 保存时删除的分支文件的后缀，全部替换成功之后再删除
+	removeSuffix = ".del"
+)
+
+//DirStore 每个分支保存在目录下的一个json文件中；只写入修改的分支，多个写入者互不影响
+type DirStore struct {
+	//Dir 保存目录
+	Dir   string
+	mu    sync.Mutex
+	saved map[string][]byte //分支 => 已经保存的内容，用于跳过没有修改的分支
+}
+
+//检查是否实现BranchStore接口
+var _ BranchStore = (*DirStore)(nil)
+
+//String 存储的描述
+func (s *DirStore) String() string {
+	return "dir:" + s.Dir
+}
+
+//branchPath 分支文件的路径
+func (s *DirStore) branchPath(name string) string {
+	return filepath.Join(s.Dir, url.PathEscape(name)+branchSuffix)
+}
+
+//Load 加载目录下所有的分支，按名称排序；分支文件损坏时使用上一个版本
+func (s *DirStore) Load() ([]*Branch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	s.saved = make(map[string][]byte)
+	list := []*Branch{}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), branchSuffix) {
+			continue
+		}
+		path := filepath.Join(s.Dir, f.Name())
+		b, data, err := loadBranch(path)
+		if err != nil {
+			log.Printf("分支文件:%s 加载失败:%v", path, err)
+			if b, data, err = loadBranch(path + ".bak"); err != nil {
+				return nil, fmt.Errorf("分支文件:%s 损坏且没有有效的备份", path)
+			}
+			log.Printf("从备份:%s 恢复分支文件", path+".bak")
+			if err = util.WriteFileAtomic(path, data, 0644); err != nil {
+				return nil, err
+			}
+		}
+		s.saved[b.Name] = data
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+//Save 写入修改的分支，删除不存在的分支；先写入所有修改的临时文件，再逐个替换与删除，
+//中途失败时恢复已经替换与删除的分支文件，保证失败时分支文件不变
+func (s *DirStore) Save(list []*Branch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	if s.saved == nil {
+		s.saved = make(map[string][]byte)
+	}
+	exists := make(map[string]bool, len(list))
+	changed := make(map[string][]byte)
+	names := []string{}
+	for _, b := range list {
+		exists[b.Name] = true
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(s.saved[b.Name], data) {
+			changed[b.Name] = data
+			names = append(names, b.Name)
+		}
+	}
+	removed := []string{}
+	for name := range s.saved {
+		if !exists[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	defer func() { //替换成功之后临时文件已经不存在
+		for _, name := range names {
+			os.Remove(s.branchPath(name) + stageSuffix)
+		}
+	}()
+	for _, name := range names { //写入临时文件，失败时分支文件没有修改
+		if err := util.WriteFileAtomic(s.branchPath(name)+stageSuffix, changed[name], 0644); err != nil {
+			return err
+		}
+	}
+	undo := []func() error{}
+	rollback := func(err error) error {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if uerr := undo[i](); uerr != nil {
+				log.Printf("分支文件恢复失败:%v", uerr)
+			}
+		}
+		return err
+	}
+	for _, name := range names {
+		path := s.branchPath(name)
+		old, rerr := ioutil.ReadFile(path)
+		if rerr == nil { //保留上一个版本，失败时也用于恢复
+			if err := util.WriteFileAtomic(path+".bak", old, 0644); err != nil {
+				return rollback(err)
+			}
+		}
+		if err := os.Rename(path+stageSuffix, path); err != nil {
+			return rollback(err)
+		}
+		undo = append(undo, func() error {
+			if rerr != nil { //新增的分支
+				return os.Remove(path)
+			}
+			return util.WriteFileAtomic(path, old, 0644)
+		})
+	}
+	for _, name := range removed {
+		path := s.branchPath(name)
+		if err := os.Rename(path, path+removeSuffix); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return rollback(err)
+		}
+		undo = append(undo, func() error { return os.Rename(path+removeSuffix, path) })
+	}
+	for _, name := range removed {
+		path := s.branchPath(name)
+		os.Remove(path + removeSuffix)
+		os.Remove(path + ".bak")
+		delete(s.saved, name)
+	}
+	for _, name := range names {
+		s.saved[name] = changed[name]
+	}
+	return nil
+}
+
+//loadBranch 读取并解析一个分支文件
+func loadBranch(path string) (*Branch, []byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	b := &Branch{}
+	if err = json.Unmarshal(data, b); err != nil {
+		return nil, nil, err
+	}
+	if len(b.Name) == 0 {
+		return nil, nil, fmt.Errorf("分支文件:%s 分支信息错误", path)
+	}
+	return b, data, nil
+}
+
+//NewDirStore 创建每个分支一个文件的存储
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{Dir: dir}
+}
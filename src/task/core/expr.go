@@ -0,0 +1,277 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//Expr 编译之后的条件表达式，例如：branch =~ "^hotfix" && vars.env == "prod" || exitCode != 0
+//
+//变量：branch、exitCode等内置变量与自定义变量，vars.开头只读取自定义变量，env.开头读取环境变量；不存在的变量为空字符串
+//字面量：双引号或者单引号的字符串(两种引号的转义相同，例如\"、\'、\\、\n)，数字，true、false
+//运算符：==、!=、=~、!~、>、<、>=、<=(同Compare)；&&、||、!、()
+//单独的值不为空、0、false时为真
+type Expr struct {
+	src  string
+	eval exprFunc
+}
+
+//exprFunc 计算表达式的结果
+type exprFunc func(lookup func(string) string) (bool, error)
+
+//operandFunc 计算操作数的值
+type operandFunc func(lookup func(string) string) string
+
+//exprParser 表达式的语法分析器
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	pos    int
+}
+
+//exprToken 表达式的词法单元
+type exprToken struct {
+	kind  byte   //i：变量；s：字面量；o：运算符
+	value string //变量名称、字面量的值或者运算符
+}
+
+//ParseExpr 编译条件表达式
+func ParseExpr(src string) (*Expr, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{src: src, tokens: tokens}
+	eval, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("表达式:%s 多余的内容:%s", src, p.tokens[p.pos].value)
+	}
+	return &Expr{src: src, eval: eval}, nil
+}
+
+//Eval 计算表达式，lookup获取变量的值
+func (e *Expr) Eval(lookup func(string) string) (bool, error) {
+	ok, err := e.eval(lookup)
+	if err != nil {
+		return false, fmt.Errorf("表达式:%s %v", e.src, err)
+	}
+	return ok, nil
+}
+
+//String 表达式的原文
+func (e *Expr) String() string {
+	return e.src
+}
+
+//exprOps 运算符，长的在前面优先匹配
+var exprOps = []string{"&&", "||", "==", "!=", "=~", "!~", ">=", "<=", ">", "<", "!", "(", ")"}
+
+//tokenizeExpr 词法分析
+func tokenizeExpr(src string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for ; end < len(src) && src[end] != c; end++ {
+				if src[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("表达式:%s 字符串缺少%c", src, c)
+			}
+			value, err := unquoteExpr(src[i+1:end], c)
+			if err != nil {
+				return nil, fmt.Errorf("表达式:%s 字符串%s错误", src, src[i:end+1])
+			}
+			tokens = append(tokens, exprToken{'s', value})
+			i = end + 1
+		case isExprIdent(c) || c == '-' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			end := i + 1
+			for end < len(src) && (isExprIdent(src[end]) || src[end] == '.' || src[end] == '-') {
+				end++
+			}
+			word := src[i:end]
+			if _, err := strconv.ParseFloat(word, 64); err == nil || word == "true" || word == "false" {
+				tokens = append(tokens, exprToken{'s', word})
+			} else {
+				tokens = append(tokens, exprToken{'i', word})
+			}
+			i = end
+		default:
+			op := ""
+			for _, item := range exprOps {
+				if strings.HasPrefix(src[i:], item) {
+					op = item
+					break
+				}
+			}
+			if len(op) == 0 {
+				return nil, fmt.Errorf("表达式:%s 不支持的字符:%c", src, c)
+			}
+			tokens = append(tokens, exprToken{'o', op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+//unquoteExpr 处理字符串中的转义，单引号与双引号的规则相同(同go的字符串)，只是\'与\"都可以使用
+func unquoteExpr(s string, quote byte) (string, error) {
+	var buf strings.Builder
+	for len(s) > 0 {
+		if strings.HasPrefix(s, "\\'") || strings.HasPrefix(s, "\\\"") { //另一种引号也可以转义
+			buf.WriteByte(s[1])
+			s = s[2:]
+			continue
+		}
+		val, multibyte, tail, err := strconv.UnquoteChar(s, quote)
+		if err != nil {
+			return "", err
+		}
+		if val < utf8.RuneSelf || multibyte {
+			buf.WriteRune(val)
+		} else {
+			buf.WriteByte(byte(val))
+		}
+		s = tail
+	}
+	return buf.String(), nil
+}
+
+//isExprIdent 是否是变量名称的字符
+func isExprIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+//peek 当前的运算符；不是运算符时返回空
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == 'o' {
+		return p.tokens[p.pos].value
+	}
+	return ""
+}
+
+//parseOr or := and ("||" and)*
+func (p *exprParser) parseOr() (exprFunc, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek() == "||" {
+		p.pos++
+		var right exprFunc
+		if right, err = p.parseAnd(); err == nil {
+			l := left
+			left = func(lookup func(string) string) (bool, error) {
+				if ok, err := l(lookup); ok || err != nil {
+					return ok, err
+				}
+				return right(lookup)
+			}
+		}
+	}
+	return left, err
+}
+
+//parseAnd and := unary ("&&" unary)*
+func (p *exprParser) parseAnd() (exprFunc, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.peek() == "&&" {
+		p.pos++
+		var right exprFunc
+		if right, err = p.parseUnary(); err == nil {
+			l := left
+			left = func(lookup func(string) string) (bool, error) {
+				if ok, err := l(lookup); !ok || err != nil {
+					return false, err
+				}
+				return right(lookup)
+			}
+		}
+	}
+	return left, err
+}
+
+//parseUnary unary := "!" unary | "(" or ")" | compare
+func (p *exprParser) parseUnary() (exprFunc, error) {
+	switch p.peek() {
+	case "!":
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(lookup func(string) string) (bool, error) {
+			ok, err := inner(lookup)
+			return !ok, err
+		}, nil
+	case "(":
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("表达式:%s 缺少)", p.src)
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parseCompare()
+}
+
+//parseCompare compare := operand (比较运算符 operand)?
+func (p *exprParser) parseCompare() (exprFunc, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peek()
+	if !isCompareOp(op) {
+		return func(lookup func(string) string) (bool, error) {
+			val := left(lookup)
+			return len(val) > 0 && val != "0" && val != "false", nil
+		}, nil
+	}
+	p.pos++
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return func(lookup func(string) string) (bool, error) {
+		return Compare(left(lookup), op, right(lookup))
+	}, nil
+}
+
+//parseOperand operand := 变量 | 字面量
+func (p *exprParser) parseOperand() (operandFunc, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("表达式:%s 不完整", p.src)
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	switch token.kind {
+	case 's':
+		return func(func(string) string) string { return token.value }, nil
+	case 'i':
+		return func(lookup func(string) string) string { return lookup(token.value) }, nil
+	}
+	return nil, fmt.Errorf("表达式:%s 运算符%s的位置错误", p.src, token.value)
+}
+
+//isCompareOp 是否是比较运算符
+func isCompareOp(op string) bool {
+	for _, item := range CompareOps {
+		if item == op {
+			return true
+		}
+	}
+	return false
+}
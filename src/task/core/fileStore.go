@@ -0,0 +1,112 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"kite/src/util"
+)
+
+//defaultBackups 默认保留的备份数量
+const defaultBackups = 5
+
+//FileStore 所有的分支保存在一个json文件中
+type FileStore struct {
+	//Path 保存路径
+	Path string
+	//Backups 保存时保留最近几个版本的备份(Path.bak.1最新)，加载失败时从备份恢复
+	Backups int
+}
+
+//检查是否实现BranchStore接口
+var _ BranchStore = (*FileStore)(nil)
+
+//String 存储的描述
+func (s *FileStore) String() string {
+	return "file:" + s.Path
+}
+
+//Save 原子地写入配置文件，并滚动备份之前的版本
+func (s *FileStore) Save(list []*Branch) error {
+	data, err := json.Marshal(list)
+	if err != nil {
+		log.Printf("配置文件序列化失败：%v", err)
+		return err
+	}
+	s.rotate()
+	if err = util.WriteFileAtomic(s.Path, data, 0644); err != nil {
+		log.Printf("配置文件保存失败：%v", err)
+	}
+	return err
+}
+
+//rotate 滚动备份：Path.bak.1 => Path.bak.2 ...，当前的配置文件成为Path.bak.1
+func (s *FileStore) rotate() {
+	if s.Backups <= 0 || !util.FileExists(s.Path) {
+		return
+	}
+	os.Remove(s.backupPath(s.Backups))
+	for i := s.Backups - 1; i >= 1; i-- {
+		os.Rename(s.backupPath(i), s.backupPath(i+1))
+	}
+	if data, err := ioutil.ReadFile(s.Path); err == nil { //复制而不是硬链接，直接编辑配置文件不会影响备份
+		util.WriteFileAtomic(s.backupPath(1), data, 0644)
+	}
+}
+
+//backupPath 第i个备份的路径
+func (s *FileStore) backupPath(i int) string {
+	return fmt.Sprintf("%s.bak.%d", s.Path, i)
+}
+
+//Load 加载配置；配置文件损坏时从最新的有效备份恢复
+func (s *FileStore) Load() ([]*Branch, error) {
+	list, err := loadBranches(s.Path)
+	if err == nil {
+		return list, nil
+	}
+	log.Printf("配置文件:%s 加载失败:%v", s.Path, err)
+	for i := 1; i <= s.Backups; i++ {
+		backup := s.backupPath(i)
+		if list, berr := loadBranches(backup); berr == nil {
+			log.Printf("从备份:%s 恢复配置文件", backup)
+			if util.FileExists(s.Path) { //保留损坏的文件，便于排查
+				os.Rename(s.Path, s.Path+".corrupt")
+			}
+			data, _ := ioutil.ReadFile(backup)
+			if err = util.WriteFileAtomic(s.Path, data, 0644); err != nil {
+				return nil, err
+			}
+			return list, nil
+		}
+	}
+	return nil, err
+}
+
+//loadBranches 读取并解析配置文件
+func loadBranches(path string) ([]*Branch, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	list := []*Branch{}
+	if len(content) > 0 {
+		if err = json.Unmarshal(content, &list); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range list {
+		if item == nil || len(item.Name) == 0 {
+			return nil, fmt.Errorf("配置文件:%s 分支信息错误", path)
+		}
+	}
+	return list, nil
+}
+
+//NewFileStore 创建单个json文件的存储
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path, Backups: defaultBackups}
+}
@@ -7,10 +7,10 @@ import (
 	"kite/src/util"
 )
 
-// IConditions 条件接口
+// IConditions 条件接口；同一个条件会被多个会话同时执行，结果通过Eval返回，不能保存在条件中
 type IConditions interface {
 	ITask
-	GetResult() int //获取条件执行的结果
+	Eval(session *Session) (bool, error) //执行条件，返回是否满足
 }
 
 // IfElse 条件任务  分支任务
@@ -22,8 +22,8 @@ type IfElse struct {
 	ElseTask List        //与之匹配的else
 }
 
-//检查是否实现ITask接口
-var _ ITask = (*IfElse)(nil)
+//检查是否实现IParentTask接口
+var _ IParentTask = (*IfElse)(nil)
 
 func init() {
 	util.RegisterType((*IfElse)(nil))
@@ -72,7 +72,7 @@ func (i *IfElse) Init(data map[string]interface{}) error {
 // ToMap 数据转换为map
 func (i *IfElse) ToMap() map[string]interface{} {
 	data := make(map[string]interface{})
-	data["Cond"] = i.Cond.ToMap()
+	data["Cond"] = condsToArray([]IConditions{i.Cond})[0]
 	data["Body"] = i.Body.ToArray()
 	data["ElseTask"] = i.ElseTask.ToArray()
 	data["Result"] = i.Result
@@ -82,11 +82,11 @@ func (i *IfElse) ToMap() map[string]interface{} {
 
 //Run 任务运行
 func (i *IfElse) Run(session *Session) error {
-	err := i.Cond.Run(session)
+	ok, err := i.Cond.Eval(session)
 	if err != nil {
 		return err
 	}
-	if i.compu(i.Cond.GetResult()) {
+	if i.compu(boolResult(ok)) {
 		if i.Body != nil && len(i.Body) > 0 {
 			return i.Body.Run(session)
 		}
@@ -98,6 +98,11 @@ func (i *IfElse) Run(session *Session) error {
 	return nil
 }
 
+//SubLists 满足与不满足条件时执行的任务列表
+func (i *IfElse) SubLists() []List {
+	return []List{i.Body, i.ElseTask}
+}
+
 // compu 结算结果 满足条件
 func (i *IfElse) compu(result int) bool {
 	switch i.Logic {
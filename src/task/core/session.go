@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -12,17 +14,25 @@ import (
 
 // Session 会话
 type Session struct {
-	ID        string            //id
-	Ctx       context.Context   //上下文管理器
-	BMan      *BranchManager    //分支管理器
-	WorkSpace string            //WorkSpace 工作路径
-	TaskName  string            //TaskName 任务名称
-	Args      []string          //参数
-	Branch    string            //Branch 分支名称
-	Compress bool              //是否启用压缩
-	request   *message.Request  //request 请求对象
-	response  *message.Response //response 响应对象
-	write     io.Writer         //输出流
+	ID        string                 //id
+	Ctx       context.Context        //上下文管理器
+	BMan      *BranchManager         //分支管理器
+	WorkSpace string                 //WorkSpace 工作路径
+	TaskName  string                 //TaskName 任务名称
+	Args      []string               //参数
+	Branch    string                 //Branch 分支名称
+	Compress  bool                   //是否启用压缩
+	Parallel  int                    //上传文件的连接数
+	Holder    string                 //锁的持有者：user@host/会话id
+	Force     bool                   //强制释放其他人持有的锁
+	Meta      BranchMeta             //客户端提交的分支描述信息
+	Params    url.Values             //客户端附加的请求参数，例如rollback的目标版本
+	Vars      map[string]string      //自定义变量，任务配置中使用${name}引用
+	OnMessage func(*message.Message) //客户端收到服务端的消息时回调(json输出)；为空时直接输出消息的内容
+	Log       io.Writer              //执行进度等信息的输出；为空时输出到stdout
+	request   *message.Request       //request 请求对象
+	response  *message.Response      //response 响应对象
+	write     io.Writer              //输出流
 }
 
 //Request 获取请求对象
@@ -66,9 +76,10 @@ func (c *Session) Copy(w io.Writer) *Session {
 		ID:        c.ID + "/id",
 		Ctx:       c.Ctx,
 		BMan:      c.BMan,
-		Compress: c.Compress,
+		Compress:  c.Compress,
 		write:     w,
 		WorkSpace: c.WorkSpace,
+		Log:       c.Log,
 	}
 	return s
 }
@@ -83,12 +94,83 @@ func (c *Session) Printf(suc bool, typ message.Type, format string, a ...interfa
 	return c.Response().Write(c.write, message.NewMessage(suc, typ, fmt.Sprintf(format, a...)))
 }
 
-// ReplaceEnvVar 替换环境变量
-func (c *Session) ReplaceEnvVar(repl string) string {
-	branch := c.Branch
+//Logf 输出执行进度等信息，不发送给客户端
+func (c *Session) Logf(format string, a ...interface{}) {
+	w := c.Log
+	if w == nil {
+		w = os.Stdout
+	}
+	fmt.Fprintf(w, format+"\n", a...)
+}
+
+//Report 客户端输出一条消息：设置了OnMessage(json输出)时回调，否则输出消息的内容
+func (c *Session) Report(suc bool, typ message.Type, format string, a ...interface{}) {
+	msg := message.NewMessage(suc, typ, fmt.Sprintf(format, a...))
+	if c.OnMessage != nil {
+		c.OnMessage(msg)
+		return
+	}
+	fmt.Fprintf(c, "%s\n", msg.Content)
+}
+
+//Var 获取变量：内置变量、自定义变量，env.开头的读取环境变量
+func (c *Session) Var(name string) (string, bool) {
 	branchPath := filepath.Join(c.WorkSpace, c.Branch)
-	repl = strings.Replace(repl, "${branch}", branch, -1)
-	return strings.Replace(repl, "${branchPath}", branchPath, -1)
+	switch name {
+	case "branch":
+		return c.Branch, true
+	case "branchPath":
+		return branchPath, true
+	case "currentPath": //启用发布目录时的当前发布
+		return filepath.Join(branchPath, "current"), true
+	case "workspace":
+		return c.WorkSpace, true
+	case "cmd":
+		return c.TaskName, true
+	case "owner":
+		return c.Meta.Owner, true
+	case "commit":
+		return c.Meta.Commit, true
+	case "ref":
+		return c.Meta.Ref, true
+	case "desc":
+		return c.Meta.Desc, true
+	case "labels":
+		return strings.Join(c.Meta.Labels, ","), true
+	}
+	if val, ok := c.Vars[name]; ok {
+		return val, true
+	}
+	if strings.HasPrefix(name, "env.") {
+		return os.LookupEnv(strings.TrimPrefix(name, "env."))
+	}
+	return "", false
+}
+
+//SetVar 设置自定义变量
+func (c *Session) SetVar(name, val string) {
+	if c.Vars == nil {
+		c.Vars = make(map[string]string)
+	}
+	c.Vars[name] = val
+}
+
+//exprVar 表达式中变量的值：vars.开头只读取自定义变量；不存在时为空字符串，
+//exitCode不存在(还没有执行命令)时为0，exitCode != 0不会因为没有执行命令而成立
+func (c *Session) exprVar(name string) string {
+	if strings.HasPrefix(name, "vars.") {
+		return c.Vars[strings.TrimPrefix(name, "vars.")]
+	}
+	val, ok := c.Var(name)
+	if !ok && name == "exitCode" {
+		return "0"
+	}
+	return val
+}
+
+//Expand 替换字符串中的变量，语法见core.Expand
+func (c *Session) Expand(s string) (string, error) {
+	return Expand(s, c.Var)
 }
 
 //NewSession 创建一个会话
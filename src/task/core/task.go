@@ -51,6 +51,8 @@ type Task struct {
 	Type     string //任务类型
 	Ignore   bool   //是否忽略错误
 	Disabled bool   //是否禁用任务
+	When     *Expr  //表达式为真时才执行，例如vars.env == "prod"
+	Unless   *Expr  //表达式为真时不执行，例如branch =~ "^hotfix"
 	Task     ITask  //任务的实际对象
 }
 
@@ -81,6 +83,23 @@ func (t *Task) Init(data map[string]interface{}) error {
 			return fmt.Errorf("Task Disabled type error: require:(int);actual:(%T)", disabled)
 		}
 	}
+	for key, expr := range map[string]**Expr{"When": &t.When, "Unless": &t.Unless} { //执行条件
+		val, ok := data[key]
+		if !ok {
+			continue
+		}
+		src, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("Task %s type error: require:(string);actual:(%T)", key, val)
+		}
+		if len(src) == 0 {
+			continue
+		}
+		var err error
+		if *expr, err = ParseExpr(src); err != nil {
+			return fmt.Errorf("Task %s %v", key, err)
+		}
+	}
 	if temp, ok := util.NewStructPtr(t.Type); ok {
 		t.Task, ok = temp.(ITask)
 		if !ok {
@@ -113,6 +132,12 @@ func (t *Task) ToMap() map[string]interface{} {
 	} else {
 		data["Disabled"] = 0
 	}
+	if t.When != nil {
+		data["When"] = t.When.String()
+	}
+	if t.Unless != nil {
+		data["Unless"] = t.Unless.String()
+	}
 	return data
 }
 
@@ -148,15 +173,36 @@ func (t *Task) Run(session *Session) error {
 	if t.Disabled { //禁用任务
 		return nil
 	}
-	fmt.Printf("begin execute task:%s\n", t.Type)
-	err := t.Task.Run(session)
+	skip, err := t.skip(session)
+	if err == nil && skip {
+		session.Logf("skip task:%s", t.Type)
+		return nil
+	}
+	if err == nil {
+		session.Logf("begin execute task:%s", t.Type)
+		err = t.Task.Run(session)
+	}
 	if t.Ignore { //忽略错误
-		fmt.Printf("ignore err:%v\n", err)
+		session.Logf("ignore err:%v", err)
 		return nil
 	}
 	return err
 }
 
+//skip 根据When、Unless判断是否跳过任务
+func (t *Task) skip(session *Session) (bool, error) {
+	if t.When != nil {
+		ok, err := t.When.Eval(session.exprVar)
+		if err != nil || !ok {
+			return true, err
+		}
+	}
+	if t.Unless != nil {
+		return t.Unless.Eval(session.exprVar)
+	}
+	return false, nil
+}
+
 //Load 加载数据
 func Load(filePath string, unser json.Unmarshaler) error {
 	content, err := ioutil.ReadFile(filePath)
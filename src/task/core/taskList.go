@@ -9,6 +9,12 @@ import (
 // List 是一个Task任务的列表
 type List []Task
 
+//IParentTask 包含子任务列表的任务(例如IfElse)，Walk通过它遍历子任务
+type IParentTask interface {
+	ITask
+	SubLists() []List //子任务列表
+}
+
 // Init 根据数据初始化
 func (l *List) Init(data []interface{}) error {
 	*l = make([]Task, len(data))
@@ -41,6 +47,18 @@ func (l *List) Run(session *Session) error {
 	return nil
 }
 
+//Walk 依次遍历所有的任务，包括IfElse等任务中的子任务
+func (l List) Walk(f func(task *Task)) {
+	for i := range l {
+		f(&l[i])
+		if parent, ok := l[i].Task.(IParentTask); ok {
+			for _, sub := range parent.SubLists() {
+				sub.Walk(f)
+			}
+		}
+	}
+}
+
 //ToArray 将列表数据序列化为[]interface{}
 func (l *List) ToArray() []interface{} {
 	data := make([]interface{}, 0, len(*l))
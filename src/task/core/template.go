@@ -0,0 +1,159 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//templateFilters 变量的过滤器：${name|filter|filter}
+var templateFilters = map[string]func(string) string{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"slug":  slug,
+	"sha-short": func(s string) string { //git commit的前7位
+		if len(s) > 7 {
+			return s[:7]
+		}
+		return s
+	},
+	"shell": shellQuote,       //shell参数：单引号包围，例如a'b => 'a'\''b'
+	"regex": regexp.QuoteMeta, //正则表达式：转义特殊字符，按原样匹配
+}
+
+//shellQuote 使用单引号包围，作为一个shell参数，变量中的$()、;等不会被执行
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+//slug 转换为只包含小写字母、数字与-的字符串，可以用作域名，例如feature/Login => feature-login
+func slug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimRight(b.String(), "-")
+}
+
+//Expand 替换字符串中的变量：${name}、${name:-默认值}(变量不存在或者为空时使用默认值)、${name|lower|slug}(过滤器)；
+//$${表示原样输出${；没有找到且没有默认值的变量原样保留，例如shell的环境变量
+func Expand(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "$${") { //转义
+			b.WriteString("${")
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(s[i:], "${") {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		end := closeBrace(s, i+2)
+		if end == -1 {
+			return "", fmt.Errorf("变量:%s 缺少}", s[i:])
+		}
+		val, err := expandVar(s[i:end+1], s[i+2:end], lookup)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(val)
+		i = end + 1
+	}
+	return b.String(), nil
+}
+
+//closeBrace 查找与${匹配的}，默认值中可以嵌套变量
+func closeBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], "${") {
+			depth++
+			i++
+		} else if s[i] == '}' {
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+//splitFilters 按照|分隔默认值与过滤器，忽略嵌套变量中的|
+func splitFilters(expr string) []string {
+	parts := []string{}
+	depth, last := 0, 0
+	for i := 0; i < len(expr); i++ {
+		switch {
+		case strings.HasPrefix(expr[i:], "${"):
+			depth++
+			i++
+		case expr[i] == '}':
+			depth--
+		case expr[i] == '|' && depth == 0:
+			parts = append(parts, expr[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, expr[last:])
+}
+
+//validVarName 变量名称只能包含字母、数字、_、-、.；其他的(例如shell的${var#prefix})原样保留
+func validVarName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+//expandVar 计算一个变量，raw为原始的${...}
+func expandVar(raw, expr string, lookup func(string) (string, bool)) (string, error) {
+	parts := splitFilters(expr)
+	name, def, hasDef := parts[0], "", false
+	if i := strings.Index(name, ":-"); i > -1 {
+		name, def, hasDef = name[:i], name[i+2:], true
+	}
+	name = strings.TrimSpace(name)
+	if !validVarName(name) {
+		return raw, nil
+	}
+	val, ok := lookup(name)
+	if (!ok || len(val) == 0) && hasDef {
+		var err error
+		if val, err = Expand(def, lookup); err != nil {
+			return "", err
+		}
+		ok = true
+	}
+	if !ok {
+		if len(parts) > 1 {
+			return "", fmt.Errorf("变量:%s 不存在", name)
+		}
+		return raw, nil
+	}
+	for _, filter := range parts[1:] {
+		f, ok := templateFilters[strings.TrimSpace(filter)]
+		if !ok {
+			return "", fmt.Errorf("变量:%s filter:%s 不支持，可选：lower、upper、trim、slug、sha-short、shell、regex", raw, strings.TrimSpace(filter))
+		}
+		val = f(val)
+	}
+	return val, nil
+}
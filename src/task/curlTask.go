@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"kite/src/task/core"
@@ -32,6 +33,8 @@ type CurlTask struct {
 	Method CurlMethod
 	//Head http头
 	Head map[string]string
+	//outputOpt 捕获响应的配置(Output、Regexp、JSONPath)
+	outputOpt outputOption
 }
 
 //检查是否实现ITask接口
@@ -63,7 +66,7 @@ func (c *CurlTask) Init(data map[string]interface{}) error {
 			return fmt.Errorf("CurlTask Head type error")
 		}
 	}
-	return nil
+	return c.outputOpt.Init(data)
 }
 
 //ToMap 数据转换为map
@@ -73,21 +76,28 @@ func (c *CurlTask) ToMap() map[string]interface{} {
 	data["Param"] = c.Param
 	data["Method"] = c.Method
 	data["Head"] = c.Head
+	c.outputOpt.toMap(data)
 	return data
 }
 
 //Run 执行任务
 func (c *CurlTask) Run(session *core.Session) error {
 	var method = "GET"
-	var url = c.URL
-	var body = c.Param
+	url, err := session.Expand(c.URL)
+	if err != nil {
+		return err
+	}
+	body, err := session.Expand(c.Param)
+	if err != nil {
+		return err
+	}
 	if c.Method == POST {
 		method = "POST"
 	} else if len(c.Param) > 0 {
-		if strings.Index(c.Param, "?") > -1 {
-			url += "&" + c.Param
+		if strings.Index(body, "?") > -1 {
+			url += "&" + body
 		} else {
-			url += "?" + c.Param
+			url += "?" + body
 		}
 		body = ""
 	}
@@ -98,6 +108,9 @@ func (c *CurlTask) Run(session *core.Session) error {
 	}
 	if len(c.Head) > 0 {
 		for k, v := range c.Head {
+			if v, err = session.Expand(v); err != nil {
+				return err
+			}
 			request.Header.Add(k, v)
 		}
 	}
@@ -111,13 +124,18 @@ func (c *CurlTask) Run(session *core.Session) error {
 		return err
 	}
 	defer resp.Body.Close()
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Curl result resolve fail:%v\n", err)
+		return err
+	}
+	session.SetVar("statusCode", strconv.Itoa(resp.StatusCode)) //最后一个请求的http状态码
 	if resp.StatusCode != http.StatusOK {
+		c.outputOpt.capture(session, result, resp.StatusCode)
 		log.Printf("get url err code: %d\n", resp.StatusCode)
 		return fmt.Errorf("get url err code: %d", resp.StatusCode)
 	}
-	result, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Curl result resolve fail:%v\n", err)
+	if err = c.outputOpt.capture(session, result, resp.StatusCode); err != nil {
 		return err
 	}
 	session.Printf(true, message.SystemMessage, "%s", result)
@@ -27,7 +27,6 @@ func (c *DeleteTask) ToMap() map[string]interface{} {
 
 //Run 删除分支
 func (c *DeleteTask) Run(session *core.Session) error {
-	defer session.BMan.Unlock() //释放锁
-	session.BMan.DelBranch(session.Branch)
-	return session.BMan.Save()
+	defer session.BMan.Unlock(session.Branch, session.Holder, false) //释放锁
+	return session.BMan.DelBranch(session.Branch)
 }
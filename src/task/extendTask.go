@@ -0,0 +1,55 @@
+package task
+
+import (
+	"fmt"
+	"time"
+
+	"kite/src/task/core"
+	"kite/src/task/message"
+	"kite/src/util"
+)
+
+//ExtendTask 延长分支的有效期：从现在开始重新计算，客户端使用--ttl时同时修改有效期
+type ExtendTask struct{}
+
+//检查是否实现ITask接口
+var _ core.ITask = (*ExtendTask)(nil)
+
+func init() {
+	util.RegisterType((*ExtendTask)(nil))
+}
+
+//Init 数据初始化
+func (c *ExtendTask) Init(data map[string]interface{}) error {
+	return nil
+}
+
+//ToMap 数据转换为map
+func (c *ExtendTask) ToMap() map[string]interface{} {
+	return make(map[string]interface{})
+}
+
+//Run 执行任务
+func (c *ExtendTask) Run(session *core.Session) error {
+	var branch core.Branch
+	err := session.BMan.UpdateBranch(session.Branch, func(b *core.Branch) {
+		b.LastUsed = time.Now().Format(core.TimeLayout)
+		if session.Meta.TTL != 0 {
+			b.TTL = session.Meta.TTL
+		}
+		branch = *b
+	})
+	if err != nil {
+		return err
+	}
+	session.Printf(true, message.BusinessMessage, "分支:%s 过期时间:%s", branch.Name, expireText(&branch))
+	return nil
+}
+
+//expireText 分支的过期时间
+func expireText(b *core.Branch) string {
+	if at, ok := b.ExpireAt(); ok {
+		return fmt.Sprintf("%s (有效期%s)", at.Format(core.TimeLayout), time.Duration(b.TTL)*time.Second)
+	}
+	return "不过期"
+}
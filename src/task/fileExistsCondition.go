@@ -0,0 +1,71 @@
+package task
+
+import (
+	"fmt"
+	"os"
+
+	"kite/src/task/core"
+	"kite/src/util"
+)
+
+//FileExistsCondition 文件或者目录是否存在的条件
+type FileExistsCondition struct {
+	Path string //路径，支持变量
+	Type string //选填，file：必须是文件；dir：必须是目录；为空表示都可以
+}
+
+//检查是否实现IConditions接口
+var _ core.IConditions = (*FileExistsCondition)(nil)
+
+func init() {
+	util.RegisterType((*FileExistsCondition)(nil))
+}
+
+//Init 数据初始化
+func (c *FileExistsCondition) Init(data map[string]interface{}) error {
+	var ok bool
+	if c.Path, ok = data["Path"].(string); !ok {
+		return fmt.Errorf("FileExistsCondition Path type error")
+	}
+	if typ, ok := data["Type"]; ok {
+		c.Type, _ = typ.(string)
+	}
+	switch c.Type {
+	case "", "file", "dir":
+	default:
+		return fmt.Errorf("FileExistsCondition Type type error")
+	}
+	return nil
+}
+
+//ToMap 数据转换为map
+func (c *FileExistsCondition) ToMap() map[string]interface{} {
+	data := make(map[string]interface{})
+	data["Path"] = c.Path
+	data["Type"] = c.Type
+	return data
+}
+
+//Eval 检查路径是否存在，满足时返回true
+func (c *FileExistsCondition) Eval(session *core.Session) (bool, error) {
+	path, err := session.Expand(c.Path)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		return false, nil
+	case c.Type == "file":
+		return info.Mode().IsRegular(), nil
+	case c.Type == "dir":
+		return info.IsDir(), nil
+	}
+	return true, nil
+}
+
+//Run 单独执行时只计算条件，结果由IfElse等通过Eval获取
+func (c *FileExistsCondition) Run(session *core.Session) error {
+	_, err := c.Eval(session)
+	return err
+}
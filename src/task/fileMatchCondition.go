@@ -0,0 +1,74 @@
+package task
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+
+	"kite/src/task/core"
+	"kite/src/util"
+)
+
+//FileMatchCondition 文件的内容是否匹配正则表达式的条件；文件不存在时不满足
+type FileMatchCondition struct {
+	FilePath string //文件路径，支持变量
+	Regexp   string //正则表达式，支持变量
+}
+
+//检查是否实现IConditions接口
+var _ core.IConditions = (*FileMatchCondition)(nil)
+
+func init() {
+	util.RegisterType((*FileMatchCondition)(nil))
+}
+
+//Init 数据初始化
+func (c *FileMatchCondition) Init(data map[string]interface{}) error {
+	var ok bool
+	if c.FilePath, ok = data["FilePath"].(string); !ok {
+		return fmt.Errorf("FileMatchCondition FilePath type error")
+	}
+	if c.Regexp, ok = data["Regexp"].(string); !ok {
+		return fmt.Errorf("FileMatchCondition Regexp type error")
+	}
+	return nil
+}
+
+//ToMap 数据转换为map
+func (c *FileMatchCondition) ToMap() map[string]interface{} {
+	data := make(map[string]interface{})
+	data["FilePath"] = c.FilePath
+	data["Regexp"] = c.Regexp
+	return data
+}
+
+//Eval 检查文件的内容，满足时返回true
+func (c *FileMatchCondition) Eval(session *core.Session) (bool, error) {
+	path, err := session.Expand(c.FilePath)
+	if err != nil {
+		return false, err
+	}
+	pattern, err := session.Expand(c.Regexp)
+	if err != nil {
+		return false, err
+	}
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return reg.Match(data), nil
+}
+
+//Run 单独执行时只计算条件，结果由IfElse等通过Eval获取
+func (c *FileMatchCondition) Run(session *core.Session) error {
+	_, err := c.Eval(session)
+	return err
+}
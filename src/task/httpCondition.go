@@ -0,0 +1,116 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"kite/src/task/core"
+	"kite/src/util"
+)
+
+//defaultHTTPTimeout HTTPCondition默认的超时时间(单位：s)
+const defaultHTTPTimeout = 10
+
+//HTTPCondition GET请求的状态码等于Status并且响应匹配Regexp的条件；请求失败时不满足，状态码保存到变量${statusCode}
+type HTTPCondition struct {
+	URL     string //请求的地址，支持变量
+	Status  int    //期望的状态码，默认200
+	Regexp  string //选填，响应必须匹配的正则表达式，支持变量
+	Timeout int    //超时时间(单位：s)，默认10
+}
+
+//检查是否实现IConditions接口
+var _ core.IConditions = (*HTTPCondition)(nil)
+
+func init() {
+	util.RegisterType((*HTTPCondition)(nil))
+}
+
+//Init 数据初始化
+func (c *HTTPCondition) Init(data map[string]interface{}) error {
+	var ok bool
+	if c.URL, ok = data["Url"].(string); !ok {
+		return fmt.Errorf("HTTPCondition Url type error")
+	}
+	c.Status = http.StatusOK
+	if status, ok := data["Status"]; ok {
+		ii, ok := status.(float64)
+		if !ok {
+			return fmt.Errorf("HTTPCondition Status type error")
+		}
+		c.Status = int(ii)
+	}
+	if reg, ok := data["Regexp"]; ok {
+		if c.Regexp, ok = reg.(string); !ok {
+			return fmt.Errorf("HTTPCondition Regexp type error")
+		}
+	}
+	c.Timeout = defaultHTTPTimeout
+	if timeout, ok := data["Timeout"]; ok {
+		ii, ok := timeout.(float64)
+		if !ok || ii <= 0 {
+			return fmt.Errorf("HTTPCondition Timeout type error")
+		}
+		c.Timeout = int(ii)
+	}
+	return nil
+}
+
+//ToMap 数据转换为map
+func (c *HTTPCondition) ToMap() map[string]interface{} {
+	data := make(map[string]interface{})
+	data["Url"] = c.URL
+	data["Status"] = c.Status
+	data["Regexp"] = c.Regexp
+	data["Timeout"] = c.Timeout
+	return data
+}
+
+//Eval 发送请求，检查状态码与响应，满足时返回true
+func (c *HTTPCondition) Eval(session *core.Session) (bool, error) {
+	url, err := session.Expand(c.URL)
+	if err != nil {
+		return false, err
+	}
+	pattern, err := session.Expand(c.Regexp)
+	if err != nil {
+		return false, err
+	}
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(session.Ctx, time.Duration(c.Timeout)*time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		session.Logf("HTTPCondition request fail:%v", err)
+		return false, nil
+	}
+	defer resp.Body.Close()
+	session.SetVar("statusCode", strconv.Itoa(resp.StatusCode))
+	if resp.StatusCode != c.Status {
+		return false, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		session.Logf("HTTPCondition read body fail:%v", err)
+		return false, nil
+	}
+	return reg.Match(body), nil
+}
+
+//Run 单独执行时只计算条件，结果由IfElse等通过Eval获取
+func (c *HTTPCondition) Run(session *core.Session) error {
+	_, err := c.Eval(session)
+	return err
+}
@@ -0,0 +1,72 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+
+	"kite/src/task/core"
+	"kite/src/task/message"
+	"kite/src/util"
+)
+
+//InfoTask 显示分支的详细信息
+type InfoTask struct{}
+
+//检查是否实现ITask接口
+var _ core.ITask = (*InfoTask)(nil)
+
+func init() {
+	util.RegisterType((*InfoTask)(nil))
+}
+
+//Init 数据初始化
+func (c *InfoTask) Init(data map[string]interface{}) error {
+	return nil
+}
+
+//ToMap 数据转换为map
+func (c *InfoTask) ToMap() map[string]interface{} {
+	return make(map[string]interface{})
+}
+
+//Run 执行任务
+func (c *InfoTask) Run(session *core.Session) error {
+	b, ok := session.GetCurBranchEntity()
+	if !ok {
+		return core.WithCode(message.CodeNotExist, fmt.Errorf("branch:%s not exists", session.Branch))
+	}
+	release := "-"
+	if b.Release > 0 {
+		release = fmt.Sprintf("releases/%d", b.Release)
+	}
+	result := "-"
+	if r := b.LastResult; r != nil {
+		result = fmt.Sprintf("%s 成功 (%s)", r.Cmd, r.Time)
+		if !r.Success {
+			result = fmt.Sprintf("%s 失败:%s (%s)", r.Cmd, r.Message, r.Time)
+		}
+	}
+	for _, item := range [][2]string{
+		{"名称", b.Name},
+		{"路径", b.Path},
+		{"版本", fmt.Sprint(b.Version)},
+		{"当前发布", release},
+		{"负责人", b.Owner},
+		{"Commit", b.Commit},
+		{"Ref", b.Ref},
+		{"描述", b.Desc},
+		{"标签", strings.Join(b.Labels, ",")},
+		{"创建时间", b.Created},
+		{"更新时间", b.Time},
+		{"最后使用", b.LastUsed},
+		{"过期时间", expireText(b)},
+		{"最后结果", result},
+	} {
+		val := item[1]
+		if len(val) == 0 {
+			val = "-"
+		}
+		session.Printf(true, message.BusinessMessage, "%s\t%s", item[0], val)
+	}
+	return nil
+}
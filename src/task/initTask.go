@@ -1,6 +1,7 @@
 package task
 
 import (
+	"fmt"
 	"path/filepath"
 
 	"kite/src/task/core"
@@ -8,7 +9,12 @@ import (
 )
 
 //InitTask 创建分支的任务
-type InitTask struct{}
+type InitTask struct {
+	//TTL 分支默认的有效期(单位：s)，超过有效期没有使用自动删除；客户端可以使用--ttl指定；0表示不过期
+	TTL int
+	//MaxBranches 最多可以创建的分支数量，0表示不限制
+	MaxBranches int
+}
 
 //检查是否实现ITask接口
 var _ core.ITask = (*InitTask)(nil)
@@ -19,17 +25,43 @@ func init() {
 
 //Init 数据初始化
 func (c *InitTask) Init(data map[string]interface{}) error {
+	if ttl, ok := data["TTL"]; ok {
+		ii, ok := ttl.(float64)
+		if !ok || ii < 0 {
+			return fmt.Errorf("InitTask TTL type error")
+		}
+		c.TTL = int(ii)
+	}
+	if max, ok := data["MaxBranches"]; ok {
+		ii, ok := max.(float64)
+		if !ok || ii < 0 {
+			return fmt.Errorf("InitTask MaxBranches type error")
+		}
+		c.MaxBranches = int(ii)
+	}
 	return nil
 }
 
 //ToMap 数据转换为map
 func (c *InitTask) ToMap() map[string]interface{} {
-	return make(map[string]interface{})
+	data := make(map[string]interface{})
+	data["TTL"] = c.TTL
+	data["MaxBranches"] = c.MaxBranches
+	return data
 }
 
 //Run 创建分支
 func (c *InitTask) Run(session *core.Session) error {
-	session.BMan.AddBranch(session.Branch, filepath.Join(session.WorkSpace, session.Branch)) //添加分支的地址
-	defer session.BMan.Unlock()                                                              //解锁
-	return session.BMan.Save()
+	defer session.BMan.Unlock(session.Branch, session.Holder, false) //解锁
+	return session.BMan.Tx(func(tx *core.BranchTx) error {
+		if n := tx.Len(); c.MaxBranches > 0 && n >= c.MaxBranches {
+			return fmt.Errorf("环境数量已经达到上限%d，请先删除不再使用的环境", c.MaxBranches)
+		}
+		tx.AddBranch(session.Branch, filepath.Join(session.WorkSpace, session.Branch)) //添加分支的地址
+		b, _ := tx.GetBranch(session.Branch)
+		b.TTL = c.TTL
+		b.Merge(session.Meta)
+		b.LastResult = core.NewCmdResult(session.Request().Cmd(), nil)
+		return publishRelease(session, b, defaultKeepReleases) //切换到本次上传的发布目录
+	})
 }
@@ -1,6 +1,16 @@
 package task
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"kite/src/task/core"
 	"kite/src/task/message"
 	"kite/src/util"
@@ -22,16 +32,194 @@ func (c *ListTask) ToMap() map[string]interface{} {
 	return make(map[string]interface{})
 }
 
+//branchItem 列表中的一个分支
+type branchItem struct {
+	*core.Branch
+	Expire string    `json:"expire,omitempty"` //过期时间
+	Lock   *lockInfo `json:"lock,omitempty"`   //锁；为空表示没有锁住
+	Size   int64     `json:"size"`             //使用的空间(单位：字节)
+}
+
+//lockInfo 分支的锁
+type lockInfo struct {
+	Holder   string `json:"holder"`        //持有者
+	Cmd      string `json:"cmd,omitempty"` //持有者正在执行的命令
+	Acquired string `json:"acquired"`      //获取锁的时间
+	Global   bool   `json:"global"`        //是否是全局锁
+}
+
+//listQuery 列表的过滤、排序与输出格式，来自客户端的请求参数
+type listQuery struct {
+	name   string        //名称的通配符，例如feature-*
+	owner  string        //负责人：user或者user@host
+	labels []string      //必须包含的标签
+	older  time.Duration //最后使用时间早于多久之前
+	sort   string        //排序字段：name、version、time、created、used、size、owner；前缀-表示倒序
+	format string        //输出格式：table、json、csv
+}
+
+//sortKeys 排序字段 => 比较函数
+var sortKeys = map[string]func(a, b *branchItem) bool{
+	"name":    func(a, b *branchItem) bool { return a.Name < b.Name },
+	"version": func(a, b *branchItem) bool { return a.Version < b.Version },
+	"time":    func(a, b *branchItem) bool { return a.Time < b.Time },
+	"created": func(a, b *branchItem) bool { return a.Created < b.Created },
+	"used":    func(a, b *branchItem) bool { return lastUsed(a.Branch) < lastUsed(b.Branch) },
+	"size":    func(a, b *branchItem) bool { return a.Size < b.Size },
+	"owner":   func(a, b *branchItem) bool { return a.Owner < b.Owner },
+}
+
+//parseListQuery 解析请求参数
+func parseListQuery(get func(string) string) (*listQuery, error) {
+	q := &listQuery{
+		name:   get("name"),
+		owner:  get("ownedby"), //owner参数是客户端的负责人
+		labels: core.ParseLabels(get("label")),
+		sort:   get("sort"),
+		format: get("format"),
+	}
+	if _, err := path.Match(q.name, ""); err != nil {
+		return nil, fmt.Errorf("name:%s 格式错误:%v", q.name, err)
+	}
+	if older := get("older"); len(older) > 0 {
+		d, err := time.ParseDuration(older)
+		if err != nil {
+			return nil, fmt.Errorf("older:%s 格式错误，例如72h", older)
+		}
+		q.older = d
+	}
+	if _, ok := sortKeys[strings.TrimPrefix(q.sort, "-")]; len(q.sort) > 0 && !ok {
+		return nil, fmt.Errorf("sort:%s 不支持，可选：name、version、time、created、used、size、owner", q.sort)
+	}
+	switch q.format {
+	case "":
+		q.format = "table"
+	case "table", "json", "csv":
+	default:
+		return nil, fmt.Errorf("format:%s 不支持，可选：table、json、csv", q.format)
+	}
+	return q, nil
+}
+
+//lastUsed 最后使用时间；旧的分支没有记录时使用更新时间
+func lastUsed(b *core.Branch) string {
+	if len(b.LastUsed) > 0 {
+		return b.LastUsed
+	}
+	return b.Time
+}
+
+//match 分支是否满足过滤条件
+func (q *listQuery) match(b *core.Branch, now time.Time) bool {
+	if ok, _ := path.Match(q.name, b.Name); len(q.name) > 0 && !ok {
+		return false
+	}
+	if len(q.owner) > 0 && b.Owner != q.owner && !strings.HasPrefix(b.Owner, q.owner+"@") {
+		return false
+	}
+	for _, label := range q.labels {
+		if util.IndexOf(b.Labels, label) == -1 {
+			return false
+		}
+	}
+	if q.older > 0 {
+		used, err := time.ParseInLocation(core.TimeLayout, lastUsed(b), time.Local)
+		if err != nil || now.Sub(used) < q.older {
+			return false
+		}
+	}
+	return true
+}
+
 //Run 执行任务
 func (c *ListTask) Run(session *core.Session) error {
-	session.Printf(true, message.BusinessMessage, "%s\t%s\t%s", "名称", "版本", "时间")
+	q, err := parseListQuery(session.Request().Get)
+	if err != nil {
+		return err
+	}
+	leases := make(map[string]*lockInfo)
+	for _, lease := range session.BMan.Leases() {
+		leases[lease.Branch] = &lockInfo{
+			Holder:   core.HolderName(lease.Holder), //不展示会话id
+			Cmd:      lease.Cmd,
+			Acquired: lease.Acquired.Format(core.TimeLayout),
+			Global:   lease.Branch == core.GlobalLock,
+		}
+	}
+	now := time.Now()
+	items := []*branchItem{}
 	session.BMan.Foreach(func(b *core.Branch, i int) bool {
-		session.Printf(true, message.BusinessMessage, "%s\t%d\t%s", b.Name, b.Version, b.Time)
+		if !q.match(b, now) {
+			return true
+		}
+		item := &branchItem{Branch: b, Lock: leases[b.Name]}
+		if item.Lock == nil {
+			item.Lock = leases[core.GlobalLock]
+		}
+		if at, ok := b.ExpireAt(); ok {
+			item.Expire = at.Format(core.TimeLayout)
+		}
+		item.Size, _ = branchUsage.get(b.Path)
+		items = append(items, item)
 		return true
 	})
+	if less, ok := sortKeys[strings.TrimPrefix(q.sort, "-")]; ok {
+		desc := strings.HasPrefix(q.sort, "-")
+		sort.SliceStable(items, func(i, j int) bool {
+			if desc {
+				return less(items[j], items[i])
+			}
+			return less(items[i], items[j])
+		})
+	}
+	switch q.format {
+	case "json":
+		data, err := json.Marshal(items)
+		if err != nil {
+			return err
+		}
+		session.Printf(true, message.BusinessMessage, "%s", data)
+	case "csv":
+		printCSV(session, []string{"name", "version", "time", "owner", "labels", "lock", "size", "expire"})
+		for _, item := range items {
+			printCSV(session, []string{item.Name, strconv.Itoa(item.Version), item.Time, item.Owner,
+				strings.Join(item.Labels, ","), lockHolder(item.Lock), strconv.FormatInt(item.Size, 10), item.Expire})
+		}
+	default:
+		session.Printf(true, message.BusinessMessage, "%s\t%s\t%s\t%s\t%s\t%s\t%s", "名称", "版本", "时间", "负责人", "标签", "锁", "空间")
+		for _, item := range items {
+			session.Printf(true, message.BusinessMessage, "%s\t%d\t%s\t%s\t%s\t%s\t%s", item.Name, item.Version, item.Time,
+				orDash(item.Owner), orDash(strings.Join(item.Labels, ",")), orDash(lockHolder(item.Lock)), util.FormatSize(item.Size))
+		}
+	}
 	return nil
 }
 
+//lockHolder 锁的持有者；没有锁住时返回空
+func lockHolder(lock *lockInfo) string {
+	if lock == nil {
+		return ""
+	}
+	return lock.Holder
+}
+
+//orDash 空字符串显示为-
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+//printCSV 输出一行csv
+func printCSV(session *core.Session, record []string) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(record)
+	w.Flush()
+	session.Printf(true, message.BusinessMessage, "%s", strings.TrimRight(buf.String(), "\r\n"))
+}
+
 func init() {
 	util.RegisterType((*ListTask)(nil))
 }
@@ -0,0 +1,50 @@
+package task
+
+import (
+	"time"
+
+	"kite/src/task/core"
+	"kite/src/task/message"
+	"kite/src/util"
+)
+
+//LockStatusTask 显示所有锁的持有情况
+type LockStatusTask struct{}
+
+//检查是否实现ITask接口
+var _ core.ITask = (*LockStatusTask)(nil)
+
+func init() {
+	util.RegisterType((*LockStatusTask)(nil))
+}
+
+//Init 数据初始化
+func (c *LockStatusTask) Init(data map[string]interface{}) error {
+	return nil
+}
+
+//ToMap 数据转换为map
+func (c *LockStatusTask) ToMap() map[string]interface{} {
+	return make(map[string]interface{})
+}
+
+//Run 执行任务
+func (c *LockStatusTask) Run(session *core.Session) error {
+	session.Printf(true, message.BusinessMessage, "%s\t%s\t%s\t%s\t%s", "分支", "持有者", "命令", "持有时间", "剩余时间")
+	now := time.Now()
+	for _, lease := range session.BMan.Leases() {
+		branch, cmd, remain := lease.Branch, lease.Cmd, "-"
+		if branch == core.GlobalLock {
+			branch = "(全局)"
+		}
+		if len(cmd) == 0 {
+			cmd = "-"
+		}
+		if lease.TTL > 0 {
+			remain = (lease.TTL - now.Sub(lease.Renewed)).Round(time.Second).String()
+		}
+		session.Printf(true, message.BusinessMessage, "%s\t%s\t%s\t%s\t%s",
+			branch, core.HolderName(lease.Holder), cmd, now.Sub(lease.Acquired).Round(time.Second), remain)
+	}
+	return nil
+}
@@ -1,14 +1,33 @@
 package task
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"kite/src/task/core"
+	"kite/src/task/message"
 	"kite/src/util"
 )
 
-//LockTask 删除分支的任务
-type LockTask struct{}
+const (
+	//defaultLockTTL 默认的锁有效期(单位：s)
+	defaultLockTTL = 600
+	//lockHeartbeat 排队期间位置没有变化时，定时发送消息，检查客户端是否断开
+	lockHeartbeat = 10 * time.Second
+)
+
+//LockTask 获取分支锁的任务
+type LockTask struct {
+	//Global 获取全局锁；默认只锁住当前分支
+	Global bool
+	//TTL 锁的有效期(单位：s)，持有者执行命令时自动续期，超过有效期自动释放；默认600，0表示不过期
+	TTL int
+	//Wait 锁被占用时排队等待，而不是直接失败；同一个分支的请求先进先出
+	Wait bool
+	//MaxWait 最长的排队时间(单位：s)，超时之后失败；0表示一直等待
+	MaxWait int
+}
 
 //检查是否实现ITask接口
 var _ core.ITask = (*LockTask)(nil)
@@ -19,18 +38,82 @@ func init() {
 
 //Init 数据初始化
 func (c *LockTask) Init(data map[string]interface{}) error {
+	c.Global, _ = data["Global"].(bool)
+	c.TTL = defaultLockTTL
+	if ttl, ok := data["TTL"]; ok {
+		ii, ok := ttl.(float64)
+		if !ok || ii < 0 {
+			return fmt.Errorf("LockTask TTL type error")
+		}
+		c.TTL = int(ii)
+	}
+	c.Wait, _ = data["Wait"].(bool)
+	if wait, ok := data["MaxWait"]; ok {
+		ii, ok := wait.(float64)
+		if !ok || ii < 0 {
+			return fmt.Errorf("LockTask MaxWait type error")
+		}
+		c.MaxWait = int(ii)
+	}
 	return nil
 }
 
 //ToMap 数据转换为map
 func (c *LockTask) ToMap() map[string]interface{} {
-	return make(map[string]interface{})
+	data := make(map[string]interface{})
+	data["Global"] = c.Global
+	data["TTL"] = c.TTL
+	data["Wait"] = c.Wait
+	data["MaxWait"] = c.MaxWait
+	return data
 }
 
 //Run 获得锁
 func (c *LockTask) Run(session *core.Session) error {
-	if !session.BMan.TryLock() {
-		return fmt.Errorf("获取锁失败，请稍后重试~")
+	branch, err := lockName(session, c.Global)
+	if err != nil {
+		return err
 	}
-	return nil
+	ttl := time.Duration(c.TTL) * time.Second
+	if !c.Wait {
+		if err = session.BMan.TryLock(branch, session.Holder, ttl); err != nil {
+			return core.WithCode(message.CodeLocked, fmt.Errorf("获取锁失败，%v，请稍后重试~", err))
+		}
+		return nil
+	}
+	return c.wait(session, branch, ttl)
+}
+
+//wait 排队等待锁，排队位置变化时通知客户端
+func (c *LockTask) wait(session *core.Session, branch string, ttl time.Duration) error {
+	ctx := session.Ctx
+	if c.MaxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(c.MaxWait)*time.Second)
+		defer cancel()
+	}
+	last, printed := -1, time.Time{}
+	err := session.BMan.WaitLock(ctx, branch, session.Holder, ttl, func(ahead int) error {
+		if ahead == last && time.Since(printed) < lockHeartbeat {
+			return nil
+		}
+		last, printed = ahead, time.Now()
+		_, err := session.Printf(true, message.SystemMessage, "排队等待锁，前面还有%d个请求", ahead)
+		return err //写入失败说明客户端已经断开，退出排队
+	})
+	if err == context.DeadlineExceeded {
+		return core.WithCode(message.CodeLocked, fmt.Errorf("等待锁超时(%ds)，请稍后重试~", c.MaxWait))
+	}
+	return err
+}
+
+//lockName 获取需要锁住的名称：全局锁或者当前分支
+func lockName(session *core.Session, global bool) (string, error) {
+	if global {
+		return core.GlobalLock, nil
+	}
+	if len(session.Branch) == 0 {
+		return "", fmt.Errorf("branch is empty")
+	}
+	return session.Branch, nil
 }
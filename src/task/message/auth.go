@@ -0,0 +1,163 @@
+package message
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//signKey 签名参数的key，必须是请求行的最后一个参数
+	signKey = "&sign="
+	//defaultWindow 默认允许的时间误差
+	defaultWindow = 5 * time.Minute
+)
+
+//Signer 请求签名器(客户端使用)
+type Signer struct {
+	KeyID  string //KeyID 客户端的key id
+	Secret string //Secret 共享密钥
+}
+
+//Sign 对请求行签名，返回追加了key、ts、nonce、sign参数的请求行
+func (s *Signer) Sign(line string) string {
+	sep := "&"
+	if strings.Index(line, "?") == -1 {
+		sep = "?"
+	}
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	line = fmt.Sprintf("%s%skey=%s&ts=%d&nonce=%s", line, sep, s.KeyID, time.Now().Unix(), hex.EncodeToString(nonce))
+	return line + signKey + sign(s.Secret, line)
+}
+
+//Verifier 请求验签器(服务端使用)
+type Verifier struct {
+	keys   map[string]string    //客户端key id => 共享密钥
+	window time.Duration        //允许的时间误差，同时也是nonce的保留时间
+	nonces map[string]time.Time //已经使用过的nonce
+	purged time.Time            //上次清理nonce的时间
+	mu     sync.Mutex
+}
+
+//NewVerifier 创建一个验签器；window<=0时使用默认值(5分钟)
+func NewVerifier(keys map[string]string, window time.Duration) *Verifier {
+	if window <= 0 {
+		window = defaultWindow
+	}
+	return &Verifier{
+		keys:   keys,
+		window: window,
+		nonces: make(map[string]time.Time),
+		purged: time.Now(),
+	}
+}
+
+//Verify 校验请求的签名、时间戳，并防止重放
+func (v *Verifier) Verify(req *Request) error {
+	line, value, err := splitSign(req.raw)
+	if err != nil {
+		return err
+	}
+	keyID := req.Get("key")
+	secret, ok := v.keys[keyID]
+	if !ok {
+		return fmt.Errorf("auth fail: unknown key:%s", keyID)
+	}
+	if !hmac.Equal([]byte(sign(secret, line)), []byte(value)) {
+		return fmt.Errorf("auth fail: signature mismatch")
+	}
+	ts, err := strconv.ParseInt(req.Get("ts"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("auth fail: timestamp error")
+	}
+	now := time.Now()
+	if diff := now.Sub(time.Unix(ts, 0)); diff > v.window || diff < -v.window {
+		return fmt.Errorf("auth fail: timestamp expired")
+	}
+	nonce := keyID + ":" + req.Get("nonce")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if now.Sub(v.purged) > v.window { //清理过期的nonce
+		for k, t := range v.nonces {
+			if now.Sub(t) > v.window*2 {
+				delete(v.nonces, k)
+			}
+		}
+		v.purged = now
+	}
+	if _, ok := v.nonces[nonce]; ok {
+		return fmt.Errorf("auth fail: replayed request")
+	}
+	v.nonces[nonce] = now
+	return nil
+}
+
+//Frames 获取已经验证的请求(长连接)中后续请求的验签器；请求没有签名时返回nil
+func (v *Verifier) Frames(req *Request) *FrameSigner {
+	_, value, err := splitSign(req.raw)
+	if err != nil {
+		return nil
+	}
+	return &FrameSigner{secret: v.keys[req.Get("key")], conn: value}
+}
+
+//Frames 获取长连接中后续请求的签名器，line为已经签名的连接请求行
+func (s *Signer) Frames(line string) *FrameSigner {
+	_, value, _ := splitSign(line)
+	return &FrameSigner{secret: s.Secret, conn: value}
+}
+
+//FrameSigner 长连接中后续请求的签名器：签名包含连接请求的签名与请求的顺序，
+//后续的请求不能被修改、重放到其他连接或者调整顺序
+type FrameSigner struct {
+	secret string //共享密钥
+	conn   string //连接请求的签名
+	count  int    //已经签名(或者验签)的请求数量
+}
+
+//Sign 对后续的请求行签名，返回追加了sign参数的请求行
+func (f *FrameSigner) Sign(line string) string {
+	f.count++
+	return line + signKey + f.sign(line)
+}
+
+//Verify 按顺序校验后续请求的签名
+func (f *FrameSigner) Verify(req *Request) error {
+	line, value, err := splitSign(req.raw)
+	if err != nil {
+		return err
+	}
+	f.count++
+	if !hmac.Equal([]byte(f.sign(line)), []byte(value)) {
+		return fmt.Errorf("auth fail: signature mismatch")
+	}
+	return nil
+}
+
+//sign 计算后续请求的签名
+func (f *FrameSigner) sign(line string) string {
+	return sign(f.secret, fmt.Sprintf("%s\n%d\n%s", f.conn, f.count, line))
+}
+
+//splitSign 分离请求行与签名；签名必须是最后一个参数，签名之后的内容都会导致验签失败
+func splitSign(raw string) (string, string, error) {
+	idx := strings.LastIndex(raw, signKey)
+	if idx == -1 {
+		return "", "", fmt.Errorf("auth fail: request not signed")
+	}
+	return raw[:idx], raw[idx+len(signKey):], nil
+}
+
+//sign 计算hmac-sha256签名
+func sign(secret, line string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(line))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,343 @@
+package message
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"kite/src/util"
+)
+
+const (
+	//partSuffix 未上传完成的文件后缀
+	partSuffix = ".kite-part"
+	//stateSuffix 未上传完成的文件状态的后缀
+	stateSuffix = ".kite-part.json"
+)
+
+//partChunk 已经确认的文件块
+type partChunk struct {
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Md5    string `json:"md5"`
+}
+
+//partState 未上传完成的文件状态
+type partState struct {
+	Md5    string      `json:"md5"`    //整个文件的md5
+	Size   int64       `json:"size"`   //整个文件的大小
+	Chunks []partChunk `json:"chunks"` //已经确认的文件块
+}
+
+//offset 已经确认的偏移量
+func (p *partState) offset() int64 {
+	if len(p.Chunks) == 0 {
+		return 0
+	}
+	last := p.Chunks[len(p.Chunks)-1]
+	return last.Offset + last.Length
+}
+
+//ChunkMessage 分块上传的消息；大文件分块上传，中断之后从服务端已经确认的偏移量继续上传
+type ChunkMessage struct {
+	Path     string        //路径
+	Branch   string        //分支
+	Md5      string        //整个文件的md5
+	Size     int64         //整个文件的大小
+	Offset   int64         //文件块的偏移量
+	Raw      int64         //文件块的长度
+	Length   int64         //文件块在请求中的长度(压缩后的长度)
+	ChunkMd5 string        //文件块的md5
+	Compress CompressType  //压缩类型
+	Perm     os.FileMode   //文件权限；0表示不处理权限
+	Seq      int           //序号，用于确认
+	Query    bool          //只查询服务端已经确认的偏移量
+	local    string        //本地路径(客户端使用)
+	file     io.ReadCloser //文件块的内容
+	body     io.Reader     //请求中未解压的文件块(服务端使用)
+}
+
+//检查是否实现IMessage接口
+var _ IMessage = (*ChunkMessage)(nil)
+
+//String 将数据转换为字符串
+func (c *ChunkMessage) String() string {
+	return fmt.Sprintf("%s:%s:%d:%d/%d", c.Branch, c.Path, c.Offset, c.Raw, c.Size)
+}
+
+//Close 关闭资源
+func (c *ChunkMessage) Close() error {
+	if c.file != nil {
+		return c.file.Close()
+	}
+	return nil
+}
+
+//Parse 读取数据
+func (c *ChunkMessage) Parse(req *Request) error {
+	var err error
+	c.Query = req.Get("op") == "offset"
+	if c.Path, err = url.PathUnescape(req.Get("path")); err != nil {
+		return err
+	}
+	c.Path = filepath.FromSlash(c.Path)
+	if c.Branch, err = url.PathUnescape(req.Get("branch")); err != nil {
+		return err
+	}
+	c.Md5 = req.Get("md5")
+	if c.Size, err = strconv.ParseInt(req.Get("size"), 10, 64); err != nil {
+		return err
+	}
+	if c.Seq, err = strconv.Atoi(req.Get("seq")); err != nil {
+		return err
+	}
+	if c.Query {
+		return nil
+	}
+	for key, val := range map[string]*int64{"offset": &c.Offset, "raw": &c.Raw, "length": &c.Length} {
+		if *val, err = strconv.ParseInt(req.Get(key), 10, 64); err != nil {
+			return err
+		}
+	}
+	c.ChunkMd5 = req.Get("chunk")
+	if perm := req.Get("perm"); len(perm) > 0 {
+		mode, err := strconv.ParseUint(perm, 8, 32)
+		if err != nil {
+			return err
+		}
+		c.Perm = os.FileMode(mode).Perm()
+	}
+	c.Compress = NONE
+	reader := io.LimitReader(req.file, c.Length)
+	c.body = reader
+	if compress, _ := strconv.ParseBool(req.Get("compress")); compress {
+		c.Compress = UNCOMPRESSION
+		c.file = util.NewUnCompressConverter(reader)
+	} else {
+		c.file = util.NewNoneConverter(reader)
+	}
+	return nil
+}
+
+//WriteTo 写入数据
+func (c *ChunkMessage) WriteTo(w io.Writer) (int64, error) {
+	path := url.PathEscape(filepath.ToSlash(filepath.Join(c.Branch, c.Path))) //将系统路径转换"/"
+	var line string
+	if c.Query {
+		line = fmt.Sprintf("/upload?op=offset&path=%s&branch=%s&md5=%s&size=%d&seq=%d",
+			path, url.PathEscape(c.Branch), c.Md5, c.Size, c.Seq)
+	} else {
+		line = fmt.Sprintf("/upload?op=chunk&path=%s&branch=%s&md5=%s&size=%d&seq=%d&offset=%d&raw=%d&length=%d&chunk=%s&compress=%s&perm=%o",
+			path, url.PathEscape(c.Branch), c.Md5, c.Size, c.Seq, c.Offset, c.Raw, c.Length, c.ChunkMd5,
+			strconv.FormatBool(c.Compress == COMPRESSION), c.Perm)
+	}
+	n, err := io.WriteString(w, line+"\n")
+	return int64(n), err
+}
+
+//SendFile 发送文件块
+func (c *ChunkMessage) SendFile(w io.Writer) (int64, error) {
+	if c.file == nil {
+		return 0, nil
+	}
+	return io.Copy(w, c.file)
+}
+
+//Drain 丢弃请求中没有读取的文件块，长连接中保证下一个请求可以正确读取
+func (c *ChunkMessage) Drain() error {
+	if c.body == nil {
+		return nil
+	}
+	_, err := io.Copy(ioutil.Discard, c.body)
+	return err
+}
+
+//Chunk 根据查询消息创建一个文件块(客户端使用)
+func (c *ChunkMessage) Chunk(offset, size int64, isCompress bool) (*ChunkMessage, error) {
+	if offset+size > c.Size {
+		size = c.Size - offset
+	}
+	file, err := os.Open(c.local)
+	if err != nil {
+		return nil, err
+	}
+	h := md5.New()
+	if _, err = io.Copy(h, io.NewSectionReader(file, offset, size)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	chunk := *c
+	chunk.Query = false
+	chunk.Offset = offset
+	chunk.Raw = size
+	chunk.Length = size
+	chunk.ChunkMd5 = fmt.Sprintf("%x", h.Sum(nil))
+	chunk.Compress = NONE
+	chunk.file = &sectionCloser{io.NewSectionReader(file, offset, size), file}
+	if isCompress {
+		cc, err := util.NewCompressConverter(chunk.file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		chunk.file = cc
+		chunk.Length = cc.Size()
+		chunk.Compress = COMPRESSION
+	}
+	return &chunk, nil
+}
+
+//ConfirmedOffset 获取服务端已经确认的偏移量；文件发生变化或者已确认的块校验失败时，从校验成功的位置重新上传
+func (c *ChunkMessage) ConfirmedOffset(path string) int64 {
+	path = filepath.Join(path, c.Path)
+	state, ok := loadPartState(path)
+	if !ok || state.Md5 != c.Md5 || state.Size != c.Size {
+		removePart(path)
+		return 0
+	}
+	part, err := os.Open(path + partSuffix)
+	if err != nil {
+		removePart(path)
+		return 0
+	}
+	defer part.Close()
+	valid := 0
+	for _, chunk := range state.Chunks {
+		h := md5.New()
+		n, err := io.Copy(h, io.NewSectionReader(part, chunk.Offset, chunk.Length))
+		if err != nil || n != chunk.Length || fmt.Sprintf("%x", h.Sum(nil)) != chunk.Md5 {
+			break
+		}
+		valid++
+	}
+	if valid < len(state.Chunks) {
+		state.Chunks = state.Chunks[:valid]
+		savePartState(path, state)
+	}
+	if state.offset() >= state.Size { //所有的块都已确认但是没有完成替换，重新上传
+		removePart(path)
+		return 0
+	}
+	return state.offset()
+}
+
+//Save 保存文件块；所有的块都上传完成之后校验md5，并替换原来的文件
+func (c *ChunkMessage) Save(path string) error {
+	path = filepath.Join(path, c.Path)
+	state, ok := loadPartState(path)
+	if !ok || state.Md5 != c.Md5 || state.Size != c.Size {
+		if c.Offset != 0 {
+			return fmt.Errorf("chunk offset err: require:0; actual:%d", c.Offset)
+		}
+		state = &partState{Md5: c.Md5, Size: c.Size}
+	}
+	if expect := state.offset(); c.Offset != expect {
+		return fmt.Errorf("chunk offset err: require:%d; actual:%d", expect, c.Offset)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	part, err := os.OpenFile(path+partSuffix, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+	if _, err = part.Seek(c.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	h := md5.New()
+	n, err := io.Copy(part, io.TeeReader(c.file, h))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if n != c.Raw || fmt.Sprintf("%x", h.Sum(nil)) != c.ChunkMd5 {
+		return fmt.Errorf("chunk check fail: offset:%d", c.Offset)
+	}
+	state.Chunks = append(state.Chunks, partChunk{Offset: c.Offset, Length: n, Md5: c.ChunkMd5})
+	if state.offset() < state.Size {
+		return savePartState(path, state)
+	}
+	//最后一块，校验整个文件
+	if err = part.Truncate(state.Size); err != nil {
+		return err
+	}
+	part.Close()
+	if util.Md5(path+partSuffix) != c.Md5 {
+		removePart(path)
+		return fmt.Errorf("file:%s md5 check fail", c.Path)
+	}
+	if c.Perm != 0 {
+		os.Chmod(path+partSuffix, c.Perm)
+	}
+	if err = os.Rename(path+partSuffix, path); err != nil {
+		return err
+	}
+	os.Remove(path + stateSuffix)
+	return nil
+}
+
+//NewChunkQuery 创建一个查询偏移量的消息(客户端使用)
+func NewChunkQuery(fpath, localpath, dstPath, branch string) (*ChunkMessage, error) {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return nil, err
+	}
+	return &ChunkMessage{
+		Path:   filepath.Join(dstPath, util.Splite(fpath, localpath)),
+		Branch: branch,
+		Md5:    util.Md5(fpath),
+		Size:   info.Size(),
+		Perm:   fileMode(info),
+		Query:  true,
+		local:  fpath,
+	}, nil
+}
+
+//loadPartState 加载未上传完成的文件状态
+func loadPartState(path string) (*partState, bool) {
+	data, err := ioutil.ReadFile(path + stateSuffix)
+	if err != nil {
+		return nil, false
+	}
+	state := &partState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, false
+	}
+	return state, true
+}
+
+//savePartState 保存未上传完成的文件状态；先写临时文件再替换，避免状态文件损坏
+func savePartState(path string, state *partState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + stateSuffix + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path+stateSuffix)
+}
+
+//removePart 删除未上传完成的文件
+func removePart(path string) {
+	os.Remove(path + partSuffix)
+	os.Remove(path + stateSuffix)
+}
+
+//sectionCloser 可以关闭的文件块
+type sectionCloser struct {
+	*io.SectionReader
+	file *os.File
+}
+
+//Close 关闭文件
+func (s *sectionCloser) Close() error {
+	return s.file.Close()
+}
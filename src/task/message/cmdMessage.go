@@ -3,6 +3,7 @@ package message
 import (
 	"fmt"
 	"io"
+	"net/url"
 )
 
 //CmdMessage 请求结构体
@@ -11,6 +12,10 @@ type CmdMessage struct {
 	Cmd string
 	//Branch 分支
 	Branch string
+	//Params 其他参数
+	Params url.Values
+	//Signer 签名器，为空时不签名
+	Signer *Signer
 }
 
 //检查是否实现IMessage接口
@@ -28,12 +33,20 @@ func (cmd *CmdMessage) Parse(req *Request) error {
 	//init?branch=11
 	cmd.Cmd = req.Cmd()
 	cmd.Branch = req.Get("branch")
+	cmd.Params = req.Query()
 	return nil
 }
 
 //WriteTo 写入数据
 func (cmd *CmdMessage) WriteTo(w io.Writer) (int64, error) {
-	n, err := io.WriteString(w, fmt.Sprintf("/%s?branch=%s\n", cmd.Cmd, cmd.Branch))
+	line := fmt.Sprintf("/%s?branch=%s", cmd.Cmd, cmd.Branch)
+	if len(cmd.Params) > 0 {
+		line += "&" + cmd.Params.Encode()
+	}
+	if cmd.Signer != nil {
+		line = cmd.Signer.Sign(line)
+	}
+	n, err := io.WriteString(w, line+"\n")
 	return int64(n), err
 }
 
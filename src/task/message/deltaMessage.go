@@ -0,0 +1,242 @@
+package message
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"kite/src/util"
+)
+
+//deltaSuffix 根据差异生成的临时文件后缀
+const deltaSuffix = ".kite-delta"
+
+//DeltaMessage 差异上传的消息；服务端返回旧文件的块签名，客户端只发送新的数据与旧文件块的序号
+type DeltaMessage struct {
+	Path     string        //路径
+	Branch   string        //分支
+	Md5      string        //新文件的md5
+	Size     int64         //新文件的大小
+	Block    int           //文件块大小
+	Length   int64         //差异在请求中的长度(压缩后的长度)
+	Compress CompressType  //压缩类型
+	Perm     os.FileMode   //文件权限；0表示不处理权限
+	Seq      int           //序号，用于确认
+	Query    bool          //只查询服务端旧文件的签名
+	local    string        //本地路径(客户端使用)
+	file     io.ReadCloser //差异的内容
+	body     io.Reader     //请求中未解压的差异(服务端使用)
+}
+
+//检查是否实现IMessage接口
+var _ IMessage = (*DeltaMessage)(nil)
+
+//String 将数据转换为字符串
+func (d *DeltaMessage) String() string {
+	return fmt.Sprintf("%s:%s:%d:%d", d.Branch, d.Path, d.Block, d.Length)
+}
+
+//Close 关闭资源
+func (d *DeltaMessage) Close() error {
+	if d.file != nil {
+		return d.file.Close()
+	}
+	return nil
+}
+
+//Parse 读取数据
+func (d *DeltaMessage) Parse(req *Request) error {
+	var err error
+	d.Query = req.Get("op") == "sig"
+	if d.Path, err = url.PathUnescape(req.Get("path")); err != nil {
+		return err
+	}
+	d.Path = filepath.FromSlash(d.Path)
+	if d.Branch, err = url.PathUnescape(req.Get("branch")); err != nil {
+		return err
+	}
+	if d.Seq, err = strconv.Atoi(req.Get("seq")); err != nil {
+		return err
+	}
+	if d.Block, err = strconv.Atoi(req.Get("block")); err != nil {
+		return err
+	}
+	if d.Block <= 0 {
+		return fmt.Errorf("delta block err:%d", d.Block)
+	}
+	if d.Query {
+		return nil
+	}
+	d.Md5 = req.Get("md5")
+	if d.Size, err = strconv.ParseInt(req.Get("size"), 10, 64); err != nil {
+		return err
+	}
+	if d.Length, err = strconv.ParseInt(req.Get("length"), 10, 64); err != nil {
+		return err
+	}
+	if perm := req.Get("perm"); len(perm) > 0 {
+		mode, err := strconv.ParseUint(perm, 8, 32)
+		if err != nil {
+			return err
+		}
+		d.Perm = os.FileMode(mode).Perm()
+	}
+	d.Compress = NONE
+	reader := io.LimitReader(req.file, d.Length)
+	d.body = reader
+	if compress, _ := strconv.ParseBool(req.Get("compress")); compress {
+		d.Compress = UNCOMPRESSION
+		d.file = util.NewUnCompressConverter(reader)
+	} else {
+		d.file = util.NewNoneConverter(reader)
+	}
+	return nil
+}
+
+//WriteTo 写入数据
+func (d *DeltaMessage) WriteTo(w io.Writer) (int64, error) {
+	path := url.PathEscape(filepath.ToSlash(filepath.Join(d.Branch, d.Path))) //将系统路径转换"/"
+	var line string
+	if d.Query {
+		line = fmt.Sprintf("/upload?op=sig&path=%s&branch=%s&seq=%d&block=%d",
+			path, url.PathEscape(d.Branch), d.Seq, d.Block)
+	} else {
+		line = fmt.Sprintf("/upload?op=delta&path=%s&branch=%s&seq=%d&block=%d&md5=%s&size=%d&length=%d&compress=%s&perm=%o",
+			path, url.PathEscape(d.Branch), d.Seq, d.Block, d.Md5, d.Size, d.Length,
+			strconv.FormatBool(d.Compress == COMPRESSION), d.Perm)
+	}
+	n, err := io.WriteString(w, line+"\n")
+	return int64(n), err
+}
+
+//SendFile 发送差异
+func (d *DeltaMessage) SendFile(w io.Writer) (int64, error) {
+	if d.file == nil {
+		return 0, nil
+	}
+	return io.Copy(w, d.file)
+}
+
+//Drain 丢弃请求中没有读取的差异，长连接中保证下一个请求可以正确读取
+func (d *DeltaMessage) Drain() error {
+	if d.body == nil {
+		return nil
+	}
+	_, err := io.Copy(ioutil.Discard, d.body)
+	return err
+}
+
+//Signature 计算服务端旧文件的签名；文件不存在时返回空字符串
+func (d *DeltaMessage) Signature(path string) (string, error) {
+	file, err := os.Open(filepath.Join(path, d.Path))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	sigs, err := util.Signatures(file, d.Block)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(util.EncodeSignatures(sigs)), nil
+}
+
+//Delta 根据服务端返回的签名生成差异消息(客户端使用)；差异不比原文件小时返回false
+func (d *DeltaMessage) Delta(signature string, isCompress bool) (*DeltaMessage, bool, error) {
+	data, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, false, err
+	}
+	sigs, err := util.DecodeSignatures(data)
+	if err != nil || len(sigs) == 0 {
+		return nil, false, err
+	}
+	file, err := os.Open(d.local)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+	var buf bytes.Buffer
+	h := md5.New()
+	if err = util.Delta(io.TeeReader(file, h), sigs, d.Block, &buf); err != nil {
+		return nil, false, err
+	}
+	if int64(buf.Len()) >= d.Size {
+		return nil, false, nil
+	}
+	delta := *d
+	delta.Query = false
+	delta.Md5 = fmt.Sprintf("%x", h.Sum(nil)) //使用生成差异时的内容，避免文件在查询之后被修改
+	delta.Length = int64(buf.Len())
+	delta.Compress = NONE
+	delta.file = ioutil.NopCloser(&buf)
+	if isCompress {
+		cc, err := util.NewCompressConverter(delta.file)
+		if err != nil {
+			return nil, false, err
+		}
+		delta.file = cc
+		delta.Length = cc.Size()
+		delta.Compress = COMPRESSION
+	}
+	return &delta, true, nil
+}
+
+//Save 根据旧文件与差异生成新文件，校验md5之后替换旧文件
+func (d *DeltaMessage) Save(path string) error {
+	path = filepath.Join(path, d.Path)
+	base, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+	tmp := path + deltaSuffix
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) //替换成功之后临时文件已经不存在
+	h := md5.New()
+	err = util.Patch(base, d.Block, d.file, io.MultiWriter(file, h))
+	file.Close()
+	if err != nil {
+		return err
+	}
+	if fmt.Sprintf("%x", h.Sum(nil)) != d.Md5 {
+		return fmt.Errorf("file:%s md5 check fail", d.Path)
+	}
+	perm := d.Perm
+	if perm == 0 { //保持旧文件的权限
+		if info, err := base.Stat(); err == nil {
+			perm = info.Mode().Perm()
+		}
+	}
+	os.Chmod(tmp, perm)
+	return os.Rename(tmp, path)
+}
+
+//NewDeltaQuery 创建一个查询旧文件签名的消息(客户端使用)
+func NewDeltaQuery(fpath, localpath, dstPath, branch string) (*DeltaMessage, error) {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return nil, err
+	}
+	return &DeltaMessage{
+		Path:   filepath.Join(dstPath, util.Splite(fpath, localpath)),
+		Branch: branch,
+		Size:   info.Size(),
+		Block:  util.DeltaBlockSize(info.Size()),
+		Perm:   fileMode(info),
+		Query:  true,
+		local:  fpath,
+	}, nil
+}
@@ -3,6 +3,7 @@ package message
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -11,6 +12,9 @@ import (
 	"kite/src/util"
 )
 
+//uploadSuffix 上传文件时写入的临时文件后缀
+const uploadSuffix = ".kite-upload"
+
 //FileMessage 文件消息 用于上传文件
 type FileMessage struct {
 	Length   int64         //文件长度
@@ -18,7 +22,12 @@ type FileMessage struct {
 	Branch   string        //分支
 	md5      string        //文件的Md5
 	Compress CompressType  //压缩类型
+	Perm     os.FileMode   //文件权限；0表示不处理权限
+	Seq      int           //序号，长连接上传时用于确认；0表示不需要确认
+	Query    bool          //只查询服务端文件的md5是否一致，不发送文件内容(长连接上传时使用)
 	file     io.ReadCloser //文件的资源地址
+	body     io.Reader     //请求中未解压的文件内容(服务端使用)
+	Signer   *Signer       //签名器，为空时不签名
 }
 
 type CompressType int //压缩类型
@@ -70,7 +79,21 @@ func (f *FileMessage) Parse(req *Request) error {
 		return err
 	}
 	f.md5 = req.Get("md5")
+	f.Query = req.Get("op") == "md5"
+	if perm := req.Get("perm"); len(perm) > 0 {
+		mode, err := strconv.ParseUint(perm, 8, 32)
+		if err != nil {
+			return err
+		}
+		f.Perm = os.FileMode(mode).Perm()
+	}
+	if seq := req.Get("seq"); len(seq) > 0 {
+		if f.Seq, err = strconv.Atoi(seq); err != nil {
+			return err
+		}
+	}
 	reader := io.LimitReader(req.file, f.Length)
+	f.body = reader
 	if f.Compress == UNCOMPRESSION {
 		f.file = util.NewUnCompressConverter(reader)
 	} else {
@@ -81,22 +104,44 @@ func (f *FileMessage) Parse(req *Request) error {
 
 //WriteTo 写入数据
 func (f *FileMessage) WriteTo(w io.Writer) (int64, error) {
-	url := fmt.Sprintf("/upload?length=%d&path=%s&branch=%s&md5=%s&compress=%s\n",
-		f.Length,
+	prefix, length := "/upload?", f.Length
+	if f.Query { //查询时不发送文件内容
+		prefix, length = "/upload?op=md5&", 0
+	}
+	url := fmt.Sprintf("%slength=%d&path=%s&branch=%s&md5=%s&compress=%s&perm=%o&seq=%d",
+		prefix,
+		length,
 		url.PathEscape(filepath.ToSlash(filepath.Join(f.Branch, f.Path))), //将系统路径转换"/"
 		url.PathEscape(f.Branch),
 		f.md5,
-		strconv.FormatBool(f.Compress == COMPRESSION))
+		strconv.FormatBool(f.Compress == COMPRESSION),
+		f.Perm,
+		f.Seq)
+	if f.Signer != nil {
+		url = f.Signer.Sign(url)
+	}
 	// log.Println(url)
-	num, err := io.WriteString(w, url)
+	num, err := io.WriteString(w, url+"\n")
 	return int64(num), err
 }
 
-// SendFile 发送文件
+// SendFile 发送文件；查询时不发送
 func (f *FileMessage) SendFile(w io.Writer) (int64, error) {
+	if f.Query {
+		return 0, nil
+	}
 	return io.Copy(w, f.file)
 }
 
+//Drain 丢弃请求中没有读取的文件内容，长连接中保证下一个请求可以正确读取
+func (f *FileMessage) Drain() error {
+	if f.body == nil {
+		return nil
+	}
+	_, err := io.Copy(ioutil.Discard, f.body)
+	return err
+}
+
 //CheckMd5 检查文件的md5是否一致
 func (f *FileMessage) CheckMd5(path string) bool {
 	path = filepath.Join(path, f.Path)
@@ -115,21 +160,27 @@ func (f *FileMessage) Save(path string) error {
 	} else if util.FileExists(path) && util.Md5(path) == f.md5 { //md5相同不需要上传
 		return nil
 	}
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	//写入临时文件之后替换，不修改原来的文件(发布目录中的文件可能是上一个版本的硬链接)
+	tmp := path + uploadSuffix
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	err = file.Truncate(0) //清空文件
-	if err != nil {
+	defer os.Remove(tmp) //替换成功之后临时文件已经不存在
+	_, err = io.Copy(file, f.file)
+	file.Close()
+	if err != nil && err != io.EOF {
 		return err
 	}
-	_, err = io.Copy(file, f.file)
-	if err == nil || err == io.EOF {
-		// fmt.Printf("upload success:%s\n", path)
-		return nil
+	// fmt.Printf("upload success:%s\n", path)
+	perm := f.Perm
+	if info, err := os.Stat(path); err == nil && perm == 0 { //保持旧文件的权限
+		perm = info.Mode().Perm()
 	}
-	return err
+	if perm != 0 {
+		os.Chmod(tmp, perm)
+	}
+	return os.Rename(tmp, path)
 }
 
 //NewFileMessage 文件消息
@@ -171,6 +222,7 @@ func NewFileMessage(fpath, localpath, dstPath, branch string, isCompress bool) (
 		file:     fwr,
 		md5:      md5,
 		Compress: ctype, //压缩类型
+		Perm:     fileMode(info),
 	}, nil
 }
 
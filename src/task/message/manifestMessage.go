@@ -0,0 +1,201 @@
+package message
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"kite/src/util"
+)
+
+//ManifestEntry 清单里面的一个文件
+type ManifestEntry struct {
+	Path  string      //路径(与FileMessage的路径一致，包含分支)
+	Size  int64       //文件大小
+	Md5   string      //文件的Md5
+	Mode  os.FileMode //文件权限；0表示不处理权限
+	local string      //本地路径(客户端使用)
+}
+
+//Match 检查服务器的文件是否与清单一致；内容一致但是权限不一致时match为true，modeDiffers为true，由调用方修改权限
+func (e *ManifestEntry) Match(path string) (match bool, modeDiffers bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || info.Size() != e.Size || util.Md5(path) != e.Md5 {
+		return false, false
+	}
+	return true, e.Mode != 0 && info.Mode().Perm() != e.Mode
+}
+
+//ManifestMessage 文件清单消息；客户端一次发送所有文件的清单，服务端返回需要上传的文件
+type ManifestMessage struct {
+	Branch   string          //分支
+	Entries  []ManifestEntry //文件清单
+	Compress bool            //清单是否压缩
+	Signer   *Signer         //签名器，为空时不签名
+}
+
+//检查是否实现IMessage接口
+var _ IMessage = (*ManifestMessage)(nil)
+
+//String 将数据转换为字符串
+func (m *ManifestMessage) String() string {
+	return fmt.Sprintf("%s:%d", m.Branch, len(m.Entries))
+}
+
+//Parse 读取数据
+func (m *ManifestMessage) Parse(req *Request) error {
+	length, err := strconv.ParseInt(req.Get("length"), 10, 0)
+	if err != nil {
+		return err
+	}
+	m.Compress, _ = strconv.ParseBool(req.Get("compress"))
+	m.Branch, err = url.PathUnescape(req.Get("branch"))
+	if err != nil {
+		return err
+	}
+	var body io.Reader = io.LimitReader(req.file, length)
+	if m.Compress {
+		body = util.NewUnCompressConverter(body)
+	}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		//md5 size mode path
+		fields := strings.SplitN(scanner.Text(), " ", 4)
+		if len(fields) != 4 {
+			return fmt.Errorf("manifest entry format err:%s", scanner.Text())
+		}
+		entry := ManifestEntry{Md5: fields[0]}
+		if entry.Size, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return err
+		}
+		mode, err := strconv.ParseUint(fields[2], 8, 32)
+		if err != nil {
+			return err
+		}
+		entry.Mode = os.FileMode(mode).Perm()
+		if entry.Path, err = url.PathUnescape(fields[3]); err != nil {
+			return err
+		}
+		entry.Path = filepath.FromSlash(entry.Path) //将"/"转换系统路径
+		m.Entries = append(m.Entries, entry)
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	if count, _ := strconv.Atoi(req.Get("count")); count != len(m.Entries) {
+		return fmt.Errorf("manifest count err: require:%d; actual:%d", count, len(m.Entries))
+	}
+	return nil
+}
+
+//WriteTo 写入数据
+func (m *ManifestMessage) WriteTo(w io.Writer) (int64, error) {
+	var body bytes.Buffer
+	for _, e := range m.Entries {
+		fmt.Fprintf(&body, "%s %d %o %s\n", e.Md5, e.Size, e.Mode, url.PathEscape(filepath.ToSlash(e.Path)))
+	}
+	data := body.Bytes()
+	if m.Compress {
+		zbuf, err := util.Compress(data)
+		if err != nil {
+			return 0, err
+		}
+		data = zbuf.Bytes()
+	}
+	line := fmt.Sprintf("/upload?op=manifest&branch=%s&count=%d&length=%d&compress=%s",
+		url.PathEscape(m.Branch), len(m.Entries), len(data), strconv.FormatBool(m.Compress))
+	if m.Signer != nil {
+		line = m.Signer.Sign(line)
+	}
+	n, err := io.WriteString(w, line+"\n")
+	if err != nil {
+		return int64(n), err
+	}
+	n2, err := w.Write(data)
+	return int64(n + n2), err
+}
+
+//ReadNeed 读取服务端的回复，返回需要上传的本地文件
+func (m *ManifestMessage) ReadNeed(r io.Reader) ([]string, error) {
+	paths, err := readPathList(r)
+	if err != nil {
+		return nil, err
+	}
+	locals := make(map[string]string, len(m.Entries))
+	for _, e := range m.Entries {
+		locals[filepath.ToSlash(e.Path)] = e.local
+	}
+	need := make([]string, 0, len(paths))
+	for _, path := range paths {
+		local, ok := locals[path]
+		if !ok {
+			return nil, fmt.Errorf("manifest response unknown path:%s", path)
+		}
+		need = append(need, local)
+	}
+	return need, nil
+}
+
+//NewManifestMessage 根据本地文件创建清单消息
+func NewManifestMessage(files []string, localpath, dstPath, branch string, isCompress bool) (*ManifestMessage, error) {
+	m := &ManifestMessage{
+		Branch:   branch,
+		Entries:  make([]ManifestEntry, 0, len(files)),
+		Compress: isCompress,
+	}
+	for _, fpath := range files {
+		info, err := os.Stat(fpath)
+		if err != nil {
+			return nil, err
+		}
+		m.Entries = append(m.Entries, ManifestEntry{
+			Path:  filepath.Join(branch, dstPath, util.Splite(fpath, localpath)),
+			Size:  info.Size(),
+			Md5:   util.Md5(fpath),
+			Mode:  fileMode(info),
+			local: fpath,
+		})
+	}
+	return m, nil
+}
+
+//fileMode 获取需要同步的文件权限；windows的权限没有意义，不同步
+func fileMode(info os.FileInfo) os.FileMode {
+	if runtime.GOOS == "windows" {
+		return 0
+	}
+	return info.Mode().Perm()
+}
+
+//readPathList 读取服务端返回的路径列表：第一条消息是数量，之后每条消息是一个路径
+func readPathList(r io.Reader) ([]string, error) {
+	reader := bufio.NewReader(r)
+	msg, err := ParseMsg(reader)
+	if err != nil {
+		return nil, err
+	}
+	if !msg.Success {
+		return nil, fmt.Errorf("%s", msg.Content)
+	}
+	count, err := strconv.Atoi(msg.Content)
+	if err != nil {
+		return nil, fmt.Errorf("path list response err:%s", msg.Content)
+	}
+	paths := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		msg, err = ParseMsg(reader)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, filepath.ToSlash(msg.Content))
+	}
+	return paths, nil
+}
@@ -0,0 +1,137 @@
+package message
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"kite/src/util"
+)
+
+//MirrorMessage 镜像消息；客户端发送本地所有文件的路径，服务端删除目录下多余的文件
+type MirrorMessage struct {
+	Branch   string   //分支
+	Root     string   //需要镜像的服务器目录(包含分支)
+	Exclude  []string //排除的文件，服务端不会删除
+	Paths    []string //客户端所有文件的路径(包含分支)
+	Compress bool     //路径列表是否压缩
+	Signer   *Signer  //签名器，为空时不签名
+}
+
+//检查是否实现IMessage接口
+var _ IMessage = (*MirrorMessage)(nil)
+
+//String 将数据转换为字符串
+func (m *MirrorMessage) String() string {
+	return fmt.Sprintf("%s:%s:%d", m.Branch, m.Root, len(m.Paths))
+}
+
+//Parse 读取数据
+func (m *MirrorMessage) Parse(req *Request) error {
+	length, err := strconv.ParseInt(req.Get("length"), 10, 0)
+	if err != nil {
+		return err
+	}
+	m.Compress, _ = strconv.ParseBool(req.Get("compress"))
+	if m.Branch, err = url.PathUnescape(req.Get("branch")); err != nil {
+		return err
+	}
+	if m.Root, err = url.PathUnescape(req.Get("root")); err != nil {
+		return err
+	}
+	m.Root = filepath.FromSlash(m.Root)
+	m.Exclude = []string{}
+	for _, ex := range req.Query()["exclude"] {
+		if len(ex) > 0 {
+			m.Exclude = append(m.Exclude, ex)
+		}
+	}
+	var body io.Reader = io.LimitReader(req.file, length)
+	if m.Compress {
+		body = util.NewUnCompressConverter(body)
+	}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		path, err := url.PathUnescape(scanner.Text())
+		if err != nil {
+			return err
+		}
+		m.Paths = append(m.Paths, filepath.FromSlash(path))
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	if count, _ := strconv.Atoi(req.Get("count")); count != len(m.Paths) {
+		return fmt.Errorf("mirror count err: require:%d; actual:%d", count, len(m.Paths))
+	}
+	return nil
+}
+
+//WriteTo 写入数据
+func (m *MirrorMessage) WriteTo(w io.Writer) (int64, error) {
+	var body bytes.Buffer
+	for _, path := range m.Paths {
+		body.WriteString(url.PathEscape(filepath.ToSlash(path)))
+		body.WriteByte('\n')
+	}
+	data := body.Bytes()
+	if m.Compress {
+		zbuf, err := util.Compress(data)
+		if err != nil {
+			return 0, err
+		}
+		data = zbuf.Bytes()
+	}
+	exclude := url.Values{"exclude": m.Exclude}
+	line := fmt.Sprintf("/upload?op=mirror&branch=%s&root=%s&count=%d&length=%d&compress=%s",
+		url.PathEscape(m.Branch), url.PathEscape(filepath.ToSlash(m.Root)), len(m.Paths), len(data), strconv.FormatBool(m.Compress))
+	if len(m.Exclude) > 0 {
+		line += "&" + exclude.Encode()
+	}
+	if m.Signer != nil {
+		line = m.Signer.Sign(line)
+	}
+	n, err := io.WriteString(w, line+"\n")
+	if err != nil {
+		return int64(n), err
+	}
+	n2, err := w.Write(data)
+	return int64(n + n2), err
+}
+
+//ReadDeleted 读取服务端的回复，返回服务端删除的文件
+func (m *MirrorMessage) ReadDeleted(r io.Reader) ([]string, error) {
+	return readPathList(r)
+}
+
+//Excluded 路径是否被排除
+func (m *MirrorMessage) Excluded(path string) bool {
+	path = filepath.ToSlash(path)
+	for _, ex := range m.Exclude {
+		if strings.Index(path, ex) > -1 {
+			return true
+		}
+	}
+	return false
+}
+
+//NewMirrorMessage 根据本地文件创建镜像消息
+func NewMirrorMessage(files []string, localpath, dstPath, branch string, exclude []string, isCompress bool) *MirrorMessage {
+	m := &MirrorMessage{
+		Branch:   branch,
+		Root:     filepath.Join(branch, dstPath),
+		Exclude:  exclude,
+		Paths:    make([]string, 0, len(files)),
+		Compress: isCompress,
+	}
+	for _, fpath := range files {
+		m.Paths = append(m.Paths, filepath.Join(branch, dstPath, util.Splite(fpath, localpath)))
+	}
+	return m
+}
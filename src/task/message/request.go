@@ -12,9 +12,12 @@ import (
 //Request 请求体
 type Request struct {
 	cmd    string
+	raw    string //原始的请求行
 	values url.Values
 	addr   net.Addr           //客户端地址
 	file   io.ReadWriteCloser //上传的文件
+	reader *bufio.Reader      //读取请求的流，长连接中用于读取后续的请求
+	frames *FrameSigner       //长连接中后续请求的验签器；为空表示不需要验签
 }
 
 //Send 发送消息
@@ -64,6 +67,34 @@ func (r *Request) ParseFormFile() (*FileMessage, error) {
 	return file, err
 }
 
+//ParseFormManifest 解析文件清单
+func (r *Request) ParseFormManifest() (*ManifestMessage, error) {
+	manifest := &ManifestMessage{}
+	err := manifest.Parse(r)
+	return manifest, err
+}
+
+//ParseFormMirror 解析镜像消息
+func (r *Request) ParseFormMirror() (*MirrorMessage, error) {
+	mirror := &MirrorMessage{}
+	err := mirror.Parse(r)
+	return mirror, err
+}
+
+//ParseFormChunk 解析分块上传的文件
+func (r *Request) ParseFormChunk() (*ChunkMessage, error) {
+	chunk := &ChunkMessage{}
+	err := chunk.Parse(r)
+	return chunk, err
+}
+
+//ParseFormDelta 解析差异上传的消息
+func (r *Request) ParseFormDelta() (*DeltaMessage, error) {
+	delta := &DeltaMessage{}
+	err := delta.Parse(r)
+	return delta, err
+}
+
 //ParseForm 解析请求
 func (r *Request) ParseForm(read io.Reader) (int64, error) {
 	nr := bufio.NewReader(read)
@@ -78,9 +109,11 @@ func (r *Request) ParseForm(read io.Reader) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	r.raw = string(head)
 	r.cmd = strings.TrimLeft(u.Path, "/")
 	r.values = u.Query()
 	r.file = &readOnly{nr}
+	r.reader = nr
 	return int64(len(head)), nil
 }
 
@@ -104,6 +137,21 @@ func (r *Request) Get(key string) string {
 	return r.values.Get(key)
 }
 
+//Reader 获取读取请求的流；长连接中后续的请求需要从这个流读取
+func (r *Request) Reader() *bufio.Reader {
+	return r.reader
+}
+
+//Frames 获取长连接中后续请求的验签器；为空表示不需要验签
+func (r *Request) Frames() *FrameSigner {
+	return r.frames
+}
+
+//SetFrames 设置长连接中后续请求的验签器
+func (r *Request) SetFrames(frames *FrameSigner) {
+	r.frames = frames
+}
+
 //Files 获取上传的文件
 func (r *Request) Files() io.Reader {
 	return r.file
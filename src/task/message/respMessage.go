@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/url"
 	"strconv"
+	"sync/atomic"
 )
 
 //IMessage 消息结构体
@@ -21,20 +22,44 @@ const (
 	SystemMessage = Type(0)
 	// BusinessMessage 业务消息
 	BusinessMessage = Type(1)
+	// AckMessage 确认消息，ID为确认的序号
+	AckMessage = Type(2)
 )
 
-//curMsgID 当前的消息id
-var curMsgID = 0
+//Code 失败的分类，客户端作为进程的退出码
+type Code int
+
+const (
+	// CodeOK 执行成功
+	CodeOK = Code(0)
+	// CodeFail 任务执行失败
+	CodeFail = Code(1)
+	// CodeConfig 配置或者参数错误
+	CodeConfig = Code(2)
+	// CodeConn 连接服务端失败
+	CodeConn = Code(3)
+	// CodeAuth 签名校验失败
+	CodeAuth = Code(4)
+	// CodeLocked 分支被其他人锁住
+	CodeLocked = Code(5)
+	// CodeNotExist 分支不存在
+	CodeNotExist = Code(6)
+)
+
+//curMsgID 当前的消息id，多个会话同时创建消息，使用atomic递增
+var curMsgID int64
 
 //检查是否实现IMessage接口
 var _ IMessage = (*Message)(nil)
 
 //Message 消息对象
 type Message struct {
-	ID      int
-	Success bool
-	Type    Type
-	Content string
+	ID      int    `json:"id"`
+	Success bool   `json:"success"`
+	Type    Type   `json:"type"`
+	Code    Code   `json:"code,omitempty"` //失败的分类；旧的服务端没有分类
+	End     bool   `json:"end,omitempty"`  //命令的最后一条消息(执行的结果)
+	Content string `json:"content"`
 }
 
 //String 将数据转换为字符串
@@ -57,9 +82,13 @@ func (m *Message) Parse(req *Request) error {
 	if req.Get("suc") == "1" {
 		m.Success = true
 	}
-	if req.Get("type") == "1" {
-		m.Type = BusinessMessage
+	if typ, err := strconv.Atoi(req.Get("type")); err == nil {
+		m.Type = Type(typ)
+	}
+	if code, err := strconv.Atoi(req.Get("code")); err == nil {
+		m.Code = Code(code)
 	}
+	m.End = req.Get("end") == "1"
 	m.Content, err = url.PathUnescape(req.Get("content"))
 	if err != nil {
 		return err
@@ -73,17 +102,31 @@ func (m *Message) WriteTo(w io.Writer) (int64, error) {
 	if m.Success {
 		suc = 1
 	}
-	n, err := io.WriteString(w, fmt.Sprintf("/msg?id=%d&suc=%d&type=%d&content=%s\n", m.ID, suc, m.Type, url.PathEscape(m.Content)))
+	code := ""
+	if m.Code != CodeOK {
+		code = fmt.Sprintf("&code=%d", m.Code)
+	}
+	if m.End {
+		code += "&end=1"
+	}
+	n, err := io.WriteString(w, fmt.Sprintf("/msg?id=%d&suc=%d&type=%d%s&content=%s\n", m.ID, suc, m.Type, code, url.PathEscape(m.Content)))
 	return int64(n), err
 }
 
 //NewMessage 创建一个消息
 func NewMessage(suc bool, typ Type, msg string) *Message {
-	curMsgID++
 	return &Message{
 		Success: suc,
 		Type:    typ,
-		ID:      curMsgID,
+		ID:      int(atomic.AddInt64(&curMsgID, 1)),
 		Content: msg,
 	}
 }
+
+//NewAckMessage 创建一个确认消息；err不为空表示处理失败
+func NewAckMessage(seq int, err error) *Message {
+	if err != nil {
+		return &Message{ID: seq, Type: AckMessage, Content: err.Error()}
+	}
+	return &Message{ID: seq, Success: true, Type: AckMessage, Content: "ok"}
+}
@@ -0,0 +1,117 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"kite/src/task/core"
+)
+
+//outputOption 捕获任务输出的配置项：输出保存到变量${Output}，退出码(或者http状态码)保存到${Output.code}
+type outputOption struct {
+	Output   string         //保存输出的变量名称；为空表示不捕获
+	Regexp   string         //选填，提取输出中匹配的内容，有分组时取第一个分组
+	JSONPath string         //选填，提取json输出中的字段，例如data.items.0.id
+	reg      *regexp.Regexp //编译之后的Regexp
+}
+
+//Init 数据初始化，所有字段都是选填
+func (o *outputOption) Init(data map[string]interface{}) error {
+	var ok bool
+	if val, has := data["Output"]; has {
+		if o.Output, ok = val.(string); !ok {
+			return fmt.Errorf("Output type error")
+		}
+	}
+	if val, has := data["Regexp"]; has {
+		if o.Regexp, ok = val.(string); !ok {
+			return fmt.Errorf("Regexp type error")
+		}
+		reg, err := regexp.Compile(o.Regexp)
+		if err != nil {
+			return fmt.Errorf("Regexp:%s err:%v", o.Regexp, err)
+		}
+		o.reg = reg
+	}
+	if val, has := data["JSONPath"]; has {
+		if o.JSONPath, ok = val.(string); !ok {
+			return fmt.Errorf("JSONPath type error")
+		}
+	}
+	return nil
+}
+
+//toMap 将配置写入map
+func (o *outputOption) toMap(data map[string]interface{}) {
+	if len(o.Output) > 0 {
+		data["Output"] = o.Output
+		data["Regexp"] = o.Regexp
+		data["JSONPath"] = o.JSONPath
+	}
+}
+
+//capture 保存任务的输出与退出码；没有配置Output时不保存
+func (o *outputOption) capture(session *core.Session, out []byte, code int) error {
+	if len(o.Output) == 0 {
+		return nil
+	}
+	session.SetVar(o.Output+".code", strconv.Itoa(code))
+	val, err := o.extract(out)
+	if err != nil {
+		return fmt.Errorf("Output:%s %v", o.Output, err)
+	}
+	session.SetVar(o.Output, val)
+	return nil
+}
+
+//extract 提取输出的内容；没有配置提取方式时返回去掉首尾空白的输出
+func (o *outputOption) extract(out []byte) (string, error) {
+	if len(o.JSONPath) > 0 {
+		var data interface{}
+		if err := json.Unmarshal(out, &data); err != nil {
+			return "", fmt.Errorf("输出不是json:%v", err)
+		}
+		return jsonPath(data, o.JSONPath)
+	}
+	if o.reg != nil {
+		match := o.reg.FindSubmatch(out)
+		if match == nil {
+			return "", fmt.Errorf("输出没有匹配:%s", o.Regexp)
+		}
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return string(match[0]), nil
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+//jsonPath 按照.分隔的路径获取json中的字段，数组使用下标；字段不是字符串时返回json
+func jsonPath(data interface{}, path string) (string, error) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := data.(type) {
+		case map[string]interface{}:
+			val, ok := node[key]
+			if !ok {
+				return "", fmt.Errorf("JSONPath:%s 字段%s不存在", path, key)
+			}
+			data = val
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", fmt.Errorf("JSONPath:%s 下标%s错误", path, key)
+			}
+			data = node[i]
+		default:
+			return "", fmt.Errorf("JSONPath:%s 字段%s不存在", path, key)
+		}
+	}
+	if s, ok := data.(string); ok {
+		return s, nil
+	}
+	val, err := json.Marshal(data)
+	return string(val), err
+}
@@ -0,0 +1,138 @@
+package task
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+
+	"kite/src/task/core"
+	"kite/src/task/message"
+	"kite/src/util"
+)
+
+//varPrefix 请求参数中变量的前缀：var.key=value
+const varPrefix = "var."
+
+//ParamTask 声明命令的参数(客户端使用--var key=value传入)，放在TaskDict命令的任务列表中；
+//执行时校验参数并设置默认值，之后的任务使用${key}引用
+type ParamTask struct {
+	Name     string   //参数名称
+	Required bool     //是否必填
+	Default  string   //没有传入时的默认值
+	Values   []string //允许的值；为空表示不限制
+}
+
+//检查是否实现ITask接口
+var _ core.ITask = (*ParamTask)(nil)
+
+func init() {
+	util.RegisterType((*ParamTask)(nil))
+}
+
+//Init 数据初始化
+func (p *ParamTask) Init(data map[string]interface{}) error {
+	var ok bool
+	if p.Name, ok = data["Name"].(string); !ok || len(p.Name) == 0 {
+		return fmt.Errorf("ParamTask Name type error")
+	}
+	if required, ok := data["Required"]; ok {
+		if p.Required, ok = required.(bool); !ok {
+			return fmt.Errorf("ParamTask Required type error")
+		}
+	}
+	if def, ok := data["Default"]; ok {
+		if p.Default, ok = def.(string); !ok {
+			return fmt.Errorf("ParamTask Default type error")
+		}
+	}
+	if values, ok := data["Values"]; ok {
+		list, ok := values.([]interface{})
+		if !ok {
+			return fmt.Errorf("ParamTask Values type error")
+		}
+		for _, v := range list {
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("ParamTask Values type error")
+			}
+			p.Values = append(p.Values, s)
+		}
+	}
+	return nil
+}
+
+//ToMap 数据转换为map
+func (p *ParamTask) ToMap() map[string]interface{} {
+	data := make(map[string]interface{})
+	data["Name"] = p.Name
+	data["Required"] = p.Required
+	data["Default"] = p.Default
+	data["Values"] = p.Values
+	return data
+}
+
+//Run 校验参数，没有传入时设置默认值
+func (p *ParamTask) Run(session *core.Session) error {
+	val := session.Vars[p.Name]
+	if len(val) == 0 {
+		if p.Required {
+			return core.WithCode(message.CodeConfig, fmt.Errorf("var:%s 必填，使用--var %s=value传入", p.Name, p.Name))
+		}
+		if len(p.Default) == 0 {
+			return nil
+		}
+		if session.Vars == nil {
+			session.Vars = make(map[string]string)
+		}
+		session.Vars[p.Name] = p.Default
+		return nil
+	}
+	if len(p.Values) > 0 && util.IndexOf(p.Values, val) == -1 {
+		return core.WithCode(message.CodeConfig, fmt.Errorf("var:%s=%s 不支持，可选：%s", p.Name, val, strings.Join(p.Values, "、")))
+	}
+	return nil
+}
+
+//varParams 变量转换为请求参数
+func varParams(vars map[string]string, params url.Values) {
+	for key, val := range vars {
+		params.Set(varPrefix+key, val)
+	}
+}
+
+//parseVars 从请求参数中解析变量
+func parseVars(query url.Values) map[string]string {
+	vars := make(map[string]string)
+	for key := range query {
+		if strings.HasPrefix(key, varPrefix) {
+			vars[strings.TrimPrefix(key, varPrefix)] = query.Get(key)
+		}
+	}
+	return vars
+}
+
+//declaredVars 只保留命令的任务列表(包括IfElse等任务中的子任务)中使用ParamTask声明的变量，没有声明的变量不能在任务中使用；
+//不返回错误，客户端的一个命令会把变量传给多个服务端命令(例如update过程中的branchExists、lock)
+func declaredVars(cmd string, list core.List, vars map[string]string) map[string]string {
+	declared := make(map[string]string)
+	list.Walk(func(item *core.Task) {
+		if p, ok := item.Task.(*ParamTask); ok {
+			if val, ok := vars[p.Name]; ok {
+				declared[p.Name] = val
+			}
+		}
+	})
+	if len(declared) < len(vars) {
+		ignored := []string{}
+		for key := range vars {
+			if _, ok := declared[key]; !ok {
+				ignored = append(ignored, key)
+			}
+		}
+		sort.Strings(ignored)
+		log.Printf("method：%s; ignore undeclared vars:%s\n", cmd, strings.Join(ignored, ","))
+	}
+	return declared
+}
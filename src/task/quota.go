@@ -0,0 +1,183 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"kite/src/task/core"
+	"kite/src/util"
+)
+
+//usageCacheTTL 分支使用空间的缓存时间，过期之后重新遍历目录
+const usageCacheTTL = 30 * time.Second
+
+//usageItem 目录已经使用的空间
+type usageItem struct {
+	size     int64     //已经使用的空间
+	computed time.Time //遍历目录的时间
+}
+
+//usageCache 上传目录已经使用的空间；上传每个文件时累加，避免每个文件都遍历目录
+type usageCache struct {
+	mu       sync.Mutex
+	items    map[string]*usageItem //上传的根目录 => 使用的空间
+	reserved map[string]int64      //上传的根目录 => 正在保存的文件预留的空间
+}
+
+//branchUsage 所有分支已经使用的空间
+var branchUsage = &usageCache{items: make(map[string]*usageItem), reserved: make(map[string]int64)}
+
+//get 获取目录已经使用的空间；遍历目录时不持有锁，避免list等遍历大目录时阻塞所有上传的空间检查
+func (c *usageCache) get(root string) (int64, error) {
+	if size, ok := c.cached(root); ok {
+		return size, nil
+	}
+	size, err := util.DirSize(root)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, ok := c.items[root]; ok && time.Since(item.computed) < usageCacheTTL { //其他请求已经计算过
+		return item.size, nil
+	}
+	c.items[root] = &usageItem{size: size, computed: time.Now()}
+	return size, nil
+}
+
+//cached 获取没有过期的缓存
+func (c *usageCache) cached(root string) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, ok := c.items[root]; ok && time.Since(item.computed) < usageCacheTTL {
+		return item.size, true
+	}
+	return 0, false
+}
+
+//reserve 在锁中检查空间并预留delta，同时上传的多个文件不会一起超出限制；used为get获取的使用空间。
+//reserve为false时只检查(计入其他上传预留的空间)，预留成功之后必须调用release
+func (c *usageCache) reserve(root string, used, delta, limit int64, reserve bool) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, ok := c.items[root]; ok { //使用最新的缓存，包括get之后其他上传累加的空间
+		used = item.size
+	}
+	used += c.reserved[root]
+	if used+delta > limit {
+		return used, errQuota
+	}
+	if reserve {
+		c.reserved[root] += delta
+	}
+	return used, nil
+}
+
+//release 文件保存结束(成功或者失败)之后释放预留的空间
+func (c *usageCache) release(root string, delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reserved[root] -= delta; c.reserved[root] <= 0 {
+		delete(c.reserved, root)
+	}
+}
+
+//add 文件保存之后累加使用的空间
+func (c *usageCache) add(root string, delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, ok := c.items[root]; ok {
+		item.size += delta
+	}
+}
+
+//reset 删除文件之后重新计算
+func (c *usageCache) reset(root string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, root)
+}
+
+//fileSize 文件的大小；文件不存在时返回0
+func fileSize(path string) int64 {
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		return info.Size()
+	}
+	return 0
+}
+
+//errQuota 超出分支的空间限制
+var errQuota = errors.New("quota exceeded")
+
+//checkSpace 检查上传之后(分支增加delta字节)是否超出分支的空间限制，以及磁盘是否还有足够的空闲空间
+func (s *ReceiveFileTask) checkSpace(session *core.Session, delta int64) error {
+	_, err := s.useSpace(session, delta, false)
+	return err
+}
+
+//useSpace 检查空间；reserve为true时为保存的文件预留分支的空间，返回需要调用branchUsage.release的根目录(没有预留时为空)
+func (s *ReceiveFileTask) useSpace(session *core.Session, delta int64, reserve bool) (string, error) {
+	if s.MinFreeSpace > 0 {
+		workspace := session.WorkSpace
+		if len(workspace) == 0 {
+			workspace = "."
+		}
+		need := delta
+		if need < 0 {
+			need = 0
+		}
+		if free, err := util.DiskFree(workspace); err == nil && free-need < s.MinFreeSpace {
+			return "", fmt.Errorf("服务器磁盘空间不足：剩余%s，上传需要%s，至少保留%s，请联系管理员清理",
+				util.FormatSize(free), util.FormatSize(need), util.FormatSize(s.MinFreeSpace))
+		}
+	}
+	if s.MaxBranchSize > 0 && delta > 0 {
+		root, err := s.branchRoot(session)
+		if err != nil {
+			return "", err
+		}
+		used, err := branchUsage.get(root)
+		if err != nil {
+			return "", err
+		}
+		if used, err = branchUsage.reserve(root, used, delta, s.MaxBranchSize, reserve); err != nil {
+			return "", fmt.Errorf("branch:%s 超出空间限制%s：已经使用(包括正在上传的文件)%s，上传还需要%s",
+				session.Branch, util.FormatSize(s.MaxBranchSize), util.FormatSize(used), util.FormatSize(delta))
+		}
+		if reserve {
+			return root, nil
+		}
+	}
+	return "", nil
+}
+
+//saveWithQuota 检查空间之后保存文件(path为相对工作区的路径，size为文件的大小)，保存成功之后累加分支使用的空间，并记录修改的文件
+func (s *ReceiveFileTask) saveWithQuota(session *core.Session, path string, size int64, save func(string) error) error {
+	full := filepath.Join(session.WorkSpace, path)
+	old := fileSize(full)
+	reserved, err := s.useSpace(session, size-old, true)
+	if err != nil {
+		return err
+	}
+	if len(reserved) > 0 { //保存结束之后释放预留的空间，成功时已经累加到使用的空间
+		defer branchUsage.release(reserved, size-old)
+	}
+	if err := save(session.WorkSpace); err != nil {
+		return err
+	}
+	root, err := s.branchRoot(session)
+	if err != nil {
+		return nil
+	}
+	if s.MaxBranchSize > 0 {
+		branchUsage.add(root, fileSize(full)-old)
+	}
+	if rel, err := filepath.Rel(root, full); err == nil {
+		uploadChanges.add(session, filepath.ToSlash(rel))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package task
+
+import (
+	"io/ioutil"
+	"log"
+	"time"
+
+	"kite/src/task/core"
+)
+
+const (
+	//defaultReapInterval 默认检查过期分支的间隔(单位：s)
+	defaultReapInterval = 300
+	//defaultReapCmd 默认删除过期分支的命令
+	defaultReapCmd = "delete"
+)
+
+//reap 定时删除过期的分支，直到会话取消
+func (t *TCPServerTask) reap(session *core.Session) {
+	ticker := time.NewTicker(time.Duration(t.ReapInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-session.Ctx.Done():
+			return
+		case <-ticker.C:
+			t.Reap(session)
+		}
+	}
+}
+
+//Reap 执行ReapCmd删除所有过期的分支，返回删除的分支；正在被其他人锁住的分支跳过，下次再检查
+func (t *TCPServerTask) Reap(session *core.Session) []string {
+	list, ok := t.TaskDict[t.ReapCmd]
+	if !ok {
+		log.Printf("reap: method：%s; not fount\n", t.ReapCmd)
+		return nil
+	}
+	holder := core.NewOwner() + "/reaper"
+	now := time.Now()
+	reaped := []string{}
+	for _, b := range session.BMan.Filter(func(b *core.Branch, _ int) bool { return b.Expired(now) }) {
+		if err := session.BMan.TryLock(b.Name, holder, defaultLockTTL*time.Second); err != nil {
+			log.Printf("reap branch:%s skipped: %v\n", b.Name, err)
+			continue
+		}
+		if cur, ok := session.BMan.GetBranch(b.Name); !ok || !cur.Expired(time.Now()) { //获取锁之前被更新或者删除
+			session.BMan.Unlock(b.Name, holder, false)
+			continue
+		}
+		s := session.Copy(ioutil.Discard)
+		s.Branch = b.Name
+		s.Holder = holder
+		err := list.Run(s)
+		session.BMan.Unlock(b.Name, holder, false)
+		if err != nil {
+			log.Printf("reap branch:%s fail: %v\n", b.Name, err)
+			continue
+		}
+		log.Printf("reap branch:%s expired at:%s\n", b.Name, expireText(b))
+		reaped = append(reaped, b.Name)
+	}
+	return reaped
+}
@@ -2,6 +2,9 @@ package task
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"kite/src/task/core"
@@ -17,6 +20,12 @@ type ReceiveFileTask struct {
 	// Port string
 	//IPLists ip白名单
 	IPLists []string
+	//Release 上传到新的发布目录releases/<版本>，UpdateTask时再切换current；默认直接写入分支目录
+	Release bool
+	//MaxBranchSize 每个分支最多使用的空间(单位：字节)，0表示不限制
+	MaxBranchSize int64
+	//MinFreeSpace 工作区所在的磁盘最少保留的空闲空间(单位：字节)，不足时拒绝上传；0表示不检查
+	MinFreeSpace int64
 }
 
 //检查是否实现ITask接口
@@ -40,6 +49,21 @@ func (s *ReceiveFileTask) Init(data map[string]interface{}) error {
 		return fmt.Errorf("ReceiveFileTask IPLists type error")
 	}
 	s.IPLists = strings.Split(iplist, " ")
+	s.Release, _ = data["Release"].(bool)
+	if size, ok := data["MaxBranchSize"]; ok {
+		ii, ok := size.(float64)
+		if !ok || ii < 0 {
+			return fmt.Errorf("ReceiveFileTask MaxBranchSize type error")
+		}
+		s.MaxBranchSize = int64(ii)
+	}
+	if size, ok := data["MinFreeSpace"]; ok {
+		ii, ok := size.(float64)
+		if !ok || ii < 0 {
+			return fmt.Errorf("ReceiveFileTask MinFreeSpace type error")
+		}
+		s.MinFreeSpace = int64(ii)
+	}
 	return nil
 }
 
@@ -49,6 +73,9 @@ func (s *ReceiveFileTask) ToMap() map[string]interface{} {
 	// data["Port"] = s.Port
 	// data["Path"] = s.Path
 	data["IPLists"] = strings.Join(s.IPLists, " ")
+	data["Release"] = s.Release
+	data["MaxBranchSize"] = s.MaxBranchSize
+	data["MinFreeSpace"] = s.MinFreeSpace
 	return data
 }
 
@@ -58,16 +85,30 @@ func (s *ReceiveFileTask) Run(session *core.Session) error {
 	if util.IndexOf(s.IPLists, ip) == -1 {
 		return fmt.Errorf("ip:%s not in the white list", ip)
 	}
+	switch session.Request().Get("op") {
+	case "manifest":
+		return s.manifest(session)
+	case "mirror":
+		return s.mirror(session)
+	case "stream":
+		return s.stream(session)
+	}
 	msg, err := session.Request().ParseFormFile()
 	if err != nil {
 		return err
 	}
+	if msg.Path, err = s.uploadPath(session, msg.Path); err != nil {
+		return err
+	}
 	if msg.CheckMd5(session.WorkSpace) { //文件md5一致，则退出接受文件
 		session.Printf(true, message.SystemMessage, "ok")
 		return nil
 	}
+	if err = s.checkSpace(session, 0); err != nil { //检查空间之后再接受文件
+		return err
+	}
 	session.Printf(true, message.SystemMessage, "ready") //表示服务器已经准备好接受文件
-	err = msg.Save(session.WorkSpace)
+	err = s.saveWithQuota(session, msg.Path, msg.Length, msg.Save)
 	//返回客户端是否成功
 	if err == nil {
 		session.Printf(true, message.SystemMessage, "ok")
@@ -76,3 +117,285 @@ func (s *ReceiveFileTask) Run(session *core.Session) error {
 	}
 	return err
 }
+
+//stream 长连接上传：连续读取多个文件(或文件块)，每个文件保存之后返回确认消息，直到客户端发送结束请求
+func (s *ReceiveFileTask) stream(session *core.Session) error {
+	if err := s.checkSpace(session, 0); err != nil { //空间不足时不接受上传
+		return err
+	}
+	reader := session.Request().Reader()
+	for {
+		if session.IsCancel() {
+			return core.ErrCANCEL
+		}
+		req := message.NewRequest()
+		if _, err := req.ParseForm(reader); err != nil {
+			return err
+		}
+		if frames := session.Request().Frames(); frames != nil {
+			if err := frames.Verify(req); err != nil {
+				return core.WithCode(message.CodeAuth, err)
+			}
+		}
+		session.BMan.Renew(session.Branch, session.Holder, "upload") //上传大量文件时续期
+		var (
+			ack *message.Message
+			err error
+		)
+		switch req.Get("op") {
+		case "end":
+			return nil
+		case "offset", "chunk":
+			ack, err = s.saveChunk(session, req)
+		case "sig", "delta":
+			ack, err = s.saveDelta(session, req)
+		case "md5":
+			ack, err = s.checkFile(session, req)
+		default:
+			ack, err = s.saveFile(session, req)
+		}
+		if err != nil { //请求格式错误，无法继续读取
+			return err
+		}
+		session.Response().Write(session, ack)
+	}
+}
+
+//saveFile 保存长连接中的一个文件
+func (s *ReceiveFileTask) saveFile(session *core.Session, req *message.Request) (*message.Message, error) {
+	msg, err := req.ParseFormFile()
+	if err != nil {
+		return nil, err
+	}
+	defer msg.Close()
+	if msg.Path, err = s.uploadPath(session, msg.Path); err == nil {
+		err = s.saveWithQuota(session, msg.Path, msg.Length, msg.Save)
+	}
+	if derr := msg.Drain(); derr != nil { //保证下一个文件可以正确读取
+		return nil, derr
+	}
+	return message.NewAckMessage(msg.Seq, err), nil
+}
+
+//checkFile 文件较少(没有发送清单)时逐个查询文件的md5是否一致；一致时返回same，否则返回空，只有权限不一致时修改权限
+func (s *ReceiveFileTask) checkFile(session *core.Session, req *message.Request) (*message.Message, error) {
+	msg, err := req.ParseFormFile()
+	if err != nil {
+		return nil, err
+	}
+	defer msg.Close()
+	ack := message.NewAckMessage(msg.Seq, nil)
+	ack.Content = ""
+	if msg.Path, err = s.uploadPath(session, msg.Path); err != nil {
+		return message.NewAckMessage(msg.Seq, err), nil
+	}
+	if !msg.CheckMd5(session.WorkSpace) {
+		return ack, nil
+	}
+	path := filepath.Join(session.WorkSpace, msg.Path)
+	if info, err := os.Stat(path); err == nil && msg.Perm != 0 && info.Mode().Perm() != msg.Perm {
+		if err = s.chmod(path, msg.Perm); err != nil {
+			return message.NewAckMessage(msg.Seq, err), nil
+		}
+	}
+	ack.Content = "same"
+	return ack, nil
+}
+
+//saveChunk 查询已经确认的偏移量，或者保存一个文件块
+func (s *ReceiveFileTask) saveChunk(session *core.Session, req *message.Request) (*message.Message, error) {
+	msg, err := req.ParseFormChunk()
+	if err != nil {
+		return nil, err
+	}
+	defer msg.Close()
+	if msg.Path, err = s.uploadPath(session, msg.Path); err == nil {
+		if msg.Query {
+			ack := message.NewAckMessage(msg.Seq, nil)
+			ack.Content = strconv.FormatInt(msg.ConfirmedOffset(session.WorkSpace), 10)
+			return ack, nil
+		}
+		err = s.saveWithQuota(session, msg.Path, msg.Size, msg.Save)
+	}
+	if derr := msg.Drain(); derr != nil {
+		return nil, derr
+	}
+	return message.NewAckMessage(msg.Seq, err), nil
+}
+
+//saveDelta 返回旧文件的签名，或者根据差异生成新文件
+func (s *ReceiveFileTask) saveDelta(session *core.Session, req *message.Request) (*message.Message, error) {
+	msg, err := req.ParseFormDelta()
+	if err != nil {
+		return nil, err
+	}
+	defer msg.Close()
+	if msg.Path, err = s.uploadPath(session, msg.Path); err == nil {
+		if msg.Query {
+			sig, err := msg.Signature(session.WorkSpace)
+			ack := message.NewAckMessage(msg.Seq, err)
+			if err == nil {
+				ack.Content = sig
+			}
+			return ack, nil
+		}
+		err = s.saveWithQuota(session, msg.Path, msg.Size, msg.Save)
+	}
+	if derr := msg.Drain(); derr != nil {
+		return nil, derr
+	}
+	return message.NewAckMessage(msg.Seq, err), nil
+}
+
+//manifest 对比文件清单，返回需要上传的文件
+func (s *ReceiveFileTask) manifest(session *core.Session) error {
+	msg, err := session.Request().ParseFormManifest()
+	if err != nil {
+		return err
+	}
+	need := []string{}
+	var delta int64 //上传之后分支增加的空间
+	for _, entry := range msg.Entries {
+		path, err := s.filePath(session, entry.Path)
+		if err != nil {
+			return err
+		}
+		match, modeDiffers := entry.Match(path)
+		if !match {
+			need = append(need, filepath.ToSlash(entry.Path))
+			delta += entry.Size - fileSize(path)
+		} else if modeDiffers { //只有权限不一致时不需要上传
+			if err = s.chmod(path, entry.Mode); err != nil {
+				return err
+			}
+		}
+	}
+	if err = s.checkSpace(session, delta); err != nil { //上传之前检查空间，避免上传到一半失败
+		return err
+	}
+	printPathList(session, need)
+	return nil
+}
+
+//mirror 删除目录下客户端不存在的文件(排除的文件除外)，返回删除的文件
+func (s *ReceiveFileTask) mirror(session *core.Session) error {
+	msg, err := session.Request().ParseFormMirror()
+	if err != nil {
+		return err
+	}
+	root, err := s.filePath(session, msg.Root)
+	if err != nil {
+		return err
+	}
+	branchRoot, err := s.branchRoot(session)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(msg.Paths))
+	for _, path := range msg.Paths {
+		full, err := s.filePath(session, path)
+		if err != nil {
+			return err
+		}
+		keep[full] = true
+	}
+	deleted := []string{}
+	dirs := []string{}
+	err = filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root { //目录不存在，不需要删除
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if msg.Excluded(path) || f.Mode()&os.ModeSymlink == os.ModeSymlink { //服务器生成的link文件不删除
+			return nil
+		}
+		if f.IsDir() {
+			if path != root {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if keep[path] {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(branchRoot, path)
+		deleted = append(deleted, filepath.ToSlash(filepath.Join(session.Branch, rel)))
+		uploadChanges.add(session, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- { //从最深的目录开始删除空目录
+		if entries, err := os.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+			os.Remove(dirs[i])
+		}
+	}
+	if len(deleted) > 0 {
+		branchUsage.reset(branchRoot)
+	}
+	printPathList(session, deleted)
+	return nil
+}
+
+//chmod 修改已经上传的文件的权限；发布目录中的文件是上一个版本的硬链接，复制之后再修改，不影响正在使用的版本
+func (s *ReceiveFileTask) chmod(path string, mode os.FileMode) error {
+	if s.Release {
+		return util.CopyMode(path, mode)
+	}
+	return os.Chmod(path, mode)
+}
+
+//printPathList 返回路径列表：第一条消息是数量，之后每条消息是一个路径
+func printPathList(session *core.Session, paths []string) {
+	session.Printf(true, message.SystemMessage, "%d", len(paths))
+	for _, path := range paths {
+		session.Printf(true, message.SystemMessage, "%s", path)
+	}
+}
+
+//branchRoot 上传文件保存的根目录：启用发布目录时为本次更新的发布目录，否则为分支目录
+func (s *ReceiveFileTask) branchRoot(session *core.Session) (string, error) {
+	if s.Release {
+		return releaseRoot(session)
+	}
+	return filepath.Join(session.WorkSpace, session.Branch), nil
+}
+
+//filePath 上传文件保存的完整路径
+func (s *ReceiveFileTask) filePath(session *core.Session, path string) (string, error) {
+	full, err := branchFilePath(session, path)
+	if err != nil || !s.Release {
+		return full, err
+	}
+	root, err := s.branchRoot(session)
+	if err != nil {
+		return "", err
+	}
+	rel, _ := filepath.Rel(filepath.Join(session.WorkSpace, session.Branch), full)
+	return filepath.Join(root, rel), nil
+}
+
+//uploadPath 上传文件保存的路径(相对工作区)，用于替换消息的路径
+func (s *ReceiveFileTask) uploadPath(session *core.Session, path string) (string, error) {
+	full, err := s.filePath(session, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(session.WorkSpace, full)
+}
+
+//branchFilePath 获取上传文件在服务器的路径，文件必须在当前分支的目录下
+func branchFilePath(session *core.Session, path string) (string, error) {
+	root := filepath.Join(session.WorkSpace, session.Branch)
+	full := filepath.Join(session.WorkSpace, path)
+	if len(session.Branch) == 0 || (full != root && !strings.HasPrefix(full, root+string(filepath.Separator))) {
+		return "", fmt.Errorf("path:%s not in branch:%s", path, session.Branch)
+	}
+	return full, nil
+}
@@ -0,0 +1,104 @@
+package task
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"kite/src/task/core"
+	"kite/src/util"
+)
+
+const (
+	//releasesDir 分支目录下保存所有发布的目录，每个版本一个子目录
+	releasesDir = "releases"
+	//currentLink 指向当前发布的符号链接
+	currentLink = "current"
+	//defaultKeepReleases 默认保留的发布数量
+	defaultKeepReleases = 5
+)
+
+//releaseMu 保护发布目录的创建，多个上传连接同时创建时只复制一次
+var releaseMu sync.Mutex
+
+//releaseRoot 本次上传的发布目录releases/<版本>；不存在时从当前发布硬链接复制，只需要上传变化的文件
+func releaseRoot(session *core.Session) (string, error) {
+	version := 1
+	if b, ok := session.GetCurBranchEntity(); ok {
+		version = b.Version + 1
+	}
+	branchPath := filepath.Join(session.WorkSpace, session.Branch)
+	dir := filepath.Join(branchPath, releasesDir, strconv.Itoa(version))
+	releaseMu.Lock()
+	defer releaseMu.Unlock()
+	if util.IsDir(dir) {
+		return dir, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), os.ModePerm); err != nil {
+		return "", err
+	}
+	current, err := filepath.EvalSymlinks(filepath.Join(branchPath, currentLink))
+	if err != nil { //还没有发布
+		return dir, os.Mkdir(dir, os.ModePerm)
+	}
+	return dir, util.LinkTree(current, dir)
+}
+
+//hasRelease 分支是否有指定版本的发布目录
+func hasRelease(session *core.Session, version int) bool {
+	return util.IsDir(filepath.Join(session.WorkSpace, session.Branch, releasesDir, strconv.Itoa(version)))
+}
+
+//switchRelease 原子地将current切换到指定版本的发布目录
+func switchRelease(session *core.Session, version int) error {
+	if !hasRelease(session, version) {
+		return fmt.Errorf("branch:%s release:%d not exists", session.Branch, version)
+	}
+	target := filepath.Join(releasesDir, strconv.Itoa(version))
+	return util.SwitchLink(target, filepath.Join(session.WorkSpace, session.Branch, currentLink))
+}
+
+//listReleases 分支所有的发布版本，从旧到新排序
+func listReleases(session *core.Session) []int {
+	entries, _ := ioutil.ReadDir(filepath.Join(session.WorkSpace, session.Branch, releasesDir))
+	versions := []int{}
+	for _, entry := range entries {
+		if version, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() { //忽略复制中的临时目录
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+//pruneReleases 删除最旧的发布，只保留keep个；当前的发布不删除
+func pruneReleases(session *core.Session, keep, current int) {
+	others := []int{}
+	for _, version := range listReleases(session) {
+		if version != current {
+			others = append(others, version)
+		}
+	}
+	for ; len(others) > 0 && len(others) >= keep; others = others[1:] { //当前的发布占用一个名额
+		os.RemoveAll(filepath.Join(session.WorkSpace, session.Branch, releasesDir, strconv.Itoa(others[0])))
+	}
+}
+
+//publishRelease 存在本次更新的发布目录时切换current并删除旧的发布，记录当前发布的版本；
+//切换之后保存分支信息失败时，下次更新使用同一个发布目录；本次更新的版本保存到变量${version}
+func publishRelease(session *core.Session, b *core.Branch, keep int) error {
+	session.SetVar("version", strconv.Itoa(b.Version))
+	if !hasRelease(session, b.Version) { //没有启用发布目录
+		return nil
+	}
+	if err := switchRelease(session, b.Version); err != nil {
+		return err
+	}
+	b.Release = b.Version
+	pruneReleases(session, keep, b.Release)
+	return nil
+}
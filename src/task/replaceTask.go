@@ -94,17 +94,29 @@ func (r *ReplaceTask) Run(session *core.Session) error {
 	if len(r.Replacer) <= 0 {
 		return nil
 	}
-	content, err := ioutil.ReadFile(r.FilePath)
+	path, err := session.Expand(r.FilePath)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
 	strContent := string(content)
 	for _, repler := range r.Replacer {
-		reg, err := regexp.Compile(session.ReplaceEnvVar(repler.Partten))
+		partten, err := session.Expand(repler.Partten)
+		if err != nil {
+			return err
+		}
+		repl, err := session.Expand(repler.Repl)
+		if err != nil {
+			return err
+		}
+		reg, err := regexp.Compile(partten)
 		if err != nil {
 			return err
 		}
-		strContent = reg.ReplaceAllString(strContent, session.ReplaceEnvVar(repler.Repl))
+		strContent = reg.ReplaceAllString(strContent, repl)
 	}
-	return ioutil.WriteFile(r.FilePath, []byte(strContent), os.ModePerm)
+	return ioutil.WriteFile(path, []byte(strContent), os.ModePerm)
 }
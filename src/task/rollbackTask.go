@@ -0,0 +1,71 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+
+	"kite/src/task/core"
+	"kite/src/task/message"
+	"kite/src/util"
+)
+
+//RollbackTask 将current切换回之前的发布；客户端使用--to指定版本，默认回滚到上一个版本
+type RollbackTask struct{}
+
+//检查是否实现ITask接口
+var _ core.ITask = (*RollbackTask)(nil)
+
+func init() {
+	util.RegisterType((*RollbackTask)(nil))
+}
+
+//Init 数据初始化
+func (c *RollbackTask) Init(data map[string]interface{}) error {
+	return nil
+}
+
+//ToMap 数据转换为map
+func (c *RollbackTask) ToMap() map[string]interface{} {
+	return make(map[string]interface{})
+}
+
+//Run 执行任务
+func (c *RollbackTask) Run(session *core.Session) error {
+	defer session.BMan.Unlock(session.Branch, session.Holder, false) //解锁
+	to, _ := strconv.Atoi(session.Request().Get("to"))
+	from := 0
+	err := session.BMan.Tx(func(tx *core.BranchTx) error {
+		b, ok := tx.GetBranch(session.Branch)
+		if !ok {
+			return core.WithCode(message.CodeNotExist, fmt.Errorf("branch:%s not exist", session.Branch))
+		}
+		if b.Release == 0 {
+			return fmt.Errorf("branch:%s 没有启用发布目录", session.Branch)
+		}
+		from = b.Release
+		if to == 0 { //上一个版本
+			for _, version := range listReleases(session) {
+				if version < b.Release {
+					to = version
+				}
+			}
+			if to == 0 {
+				return fmt.Errorf("branch:%s 没有可以回滚的版本", session.Branch)
+			}
+		}
+		if to == b.Release {
+			return fmt.Errorf("branch:%s 当前已经是版本%d", session.Branch, to)
+		}
+		if err := switchRelease(session, to); err != nil {
+			return err
+		}
+		b.Release = to
+		b.LastResult = core.NewCmdResult(session.Request().Cmd(), nil)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	session.Printf(true, message.BusinessMessage, "分支:%s 已经从版本%d回滚到版本%d", session.Branch, from, to)
+	return nil
+}
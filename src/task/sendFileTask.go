@@ -3,11 +3,12 @@ package task
 import (
 	"context"
 	"fmt"
-	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"kite/src/task/core"
 	"kite/src/task/message"
@@ -15,8 +16,18 @@ import (
 )
 
 const (
-	//maxUpload 最大上传线程
+	//maxUpload 默认的上传连接数
 	maxUpload = 4
+	//defaultManifestMin 默认启用清单同步的最小文件数
+	defaultManifestMin = 200
+	//defaultChunkThreshold 默认分块上传的最小文件大小
+	defaultChunkThreshold = 8 << 20
+	//defaultChunkSize 默认的文件块大小
+	defaultChunkSize = 2 << 20
+	//defaultRetry 默认的网络错误重试次数
+	defaultRetry = 3
+	//defaultDeltaMin 默认差异上传的最小文件大小
+	defaultDeltaMin = 1 << 20
 )
 
 var filePathErr = fmt.Errorf("file path err") //文件遍历中断错误
@@ -29,6 +40,22 @@ type SendFileTask struct {
 	Port     string   //Port 端口
 	Exclude  []string //排除文件
 	Compress bool     //是否启用压缩
+	//Mirror 上传完成之后，删除服务器目录下本地不存在的文件
+	Mirror bool
+	//ManifestMin 文件数不少于该值时，先发送文件清单，只上传服务器需要的文件；文件较少或者小于0时逐个对比md5
+	ManifestMin int
+	//Parallel 上传文件的长连接数，默认4
+	Parallel int
+	//ChunkThreshold 文件不小于该值时分块上传，中断之后从服务器已确认的位置继续上传；小于0表示不启用
+	ChunkThreshold int64
+	//ChunkSize 文件块的大小，默认2M
+	ChunkSize int64
+	//Retry 网络错误时重新连接的次数，默认3
+	Retry int
+	//DeltaMin 文件不小于该值且服务器存在旧文件时，只上传与旧文件的差异；小于0表示不启用
+	DeltaMin int64
+	tlsOpt   tlsOption  //tls配置
+	authOpt  authOption //签名配置
 }
 
 //检查是否实现ITask接口
@@ -56,6 +83,55 @@ func (s *SendFileTask) Init(data map[string]interface{}) error {
 	if s.Compress, ok = data["Compress"].(bool); !ok { //默认不压缩
 		s.Compress = false
 	}
+	s.Mirror, _ = data["Mirror"].(bool) //默认不镜像
+	s.ManifestMin = defaultManifestMin
+	if min, ok := data["ManifestMin"]; ok {
+		ii, ok := min.(float64)
+		if !ok {
+			return fmt.Errorf("SendFileTask ManifestMin type error")
+		}
+		s.ManifestMin = int(ii)
+	}
+	s.Parallel = maxUpload
+	if parallel, ok := data["Parallel"]; ok {
+		ii, ok := parallel.(float64)
+		if !ok || ii < 1 {
+			return fmt.Errorf("SendFileTask Parallel type error")
+		}
+		s.Parallel = int(ii)
+	}
+	s.ChunkThreshold = defaultChunkThreshold
+	if threshold, ok := data["ChunkThreshold"]; ok {
+		ii, ok := threshold.(float64)
+		if !ok {
+			return fmt.Errorf("SendFileTask ChunkThreshold type error")
+		}
+		s.ChunkThreshold = int64(ii)
+	}
+	s.ChunkSize = defaultChunkSize
+	if size, ok := data["ChunkSize"]; ok {
+		ii, ok := size.(float64)
+		if !ok || ii < 1 {
+			return fmt.Errorf("SendFileTask ChunkSize type error")
+		}
+		s.ChunkSize = int64(ii)
+	}
+	s.Retry = defaultRetry
+	if retry, ok := data["Retry"]; ok {
+		ii, ok := retry.(float64)
+		if !ok || ii < 0 {
+			return fmt.Errorf("SendFileTask Retry type error")
+		}
+		s.Retry = int(ii)
+	}
+	s.DeltaMin = defaultDeltaMin
+	if min, ok := data["DeltaMin"]; ok {
+		ii, ok := min.(float64)
+		if !ok {
+			return fmt.Errorf("SendFileTask DeltaMin type error")
+		}
+		s.DeltaMin = int64(ii)
+	}
 	exclude, _ := data["Exclude"].(string)
 	exclude = strings.TrimSpace(exclude)
 	if len(exclude) == 0 {
@@ -63,7 +139,10 @@ func (s *SendFileTask) Init(data map[string]interface{}) error {
 	} else {
 		s.Exclude = strings.Split(exclude, " ")
 	}
-	return nil
+	if err := s.authOpt.Init(data); err != nil {
+		return err
+	}
+	return s.tlsOpt.Init(data)
 }
 
 //ToMap 数据转换为map
@@ -74,90 +153,170 @@ func (s *SendFileTask) ToMap() map[string]interface{} {
 	data["Path"] = s.Path
 	data["DstPath"] = s.DstPath
 	data["Compress"] = s.Compress
+	data["Mirror"] = s.Mirror
+	data["ManifestMin"] = s.ManifestMin
+	data["Parallel"] = s.Parallel
+	data["ChunkThreshold"] = s.ChunkThreshold
+	data["ChunkSize"] = s.ChunkSize
+	data["Retry"] = s.Retry
+	data["DeltaMin"] = s.DeltaMin
 	data["Exclude"] = strings.Join(s.Exclude, " ")
+	s.tlsOpt.toMap(data)
+	s.authOpt.toMap(data)
 	return data
 }
 
 //Run 执行任务
 func (s *SendFileTask) Run(session *core.Session) error {
-	var (
-		errP = make(chan error)
-		errC = make(chan error)
-		err  error
-	)
 	if len(session.WorkSpace) > 0 { //如果有命令行里面携带了path，则优先使用命令行里面的path
 		s.Path = session.WorkSpace
 	}
+	var err error
+	if s.Path, err = session.Expand(s.Path); err != nil {
+		return err
+	}
+	if s.DstPath, err = session.Expand(s.DstPath); err != nil {
+		return err
+	}
 	s.Compress = session.Compress || s.Compress //设置压缩属性
+	if session.Parallel > 0 {                   //命令行里面指定的连接数优先
+		s.Parallel = session.Parallel
+	}
+	errC := make(chan error, s.Parallel) //有缓冲，多个连接同时失败时不会阻塞
 	ctxP, cancel := context.WithCancel(session.Ctx)
-	// ctxC, cancelC := context.WithCancel(session.Ctx)
-	filepipe := s.consumerPath(cancel, errC, session.Branch)
-	s.productPath(ctxP, filepipe, errP)
+	files, err := s.walk(ctxP)
+	check := s.ManifestMin < 0 || len(files) < s.ManifestMin //文件较少时逐个对比md5
+	if err == nil && !check {                                //文件较多时先对比清单，只上传服务器需要的文件
+		files, err = s.sendManifest(session, files)
+	}
+	if err != nil {
+		cancel()
+		return err
+	}
+	filepipe := s.consumerPath(cancel, errC, check, session)
+	s.productPath(ctxP, filepipe, files)
 
 	select {
-	case err = <-errP:
-		break
 	case err = <-errC:
 		break
 	case <-ctxP.Done():
-		break
+		select { //连接先发送错误再取消，取消之后错误已经在缓冲中
+		case err = <-errC:
+		default:
+		}
+	}
+	session.Logf("upload finish")
+	if err == nil && s.Mirror && !session.IsCancel() {
+		err = s.sendMirror(session)
 	}
-	fmt.Println("upload finish")
 	return err
 }
 
+//sendMirror 发送本地所有文件的路径，服务器删除多余的文件
+func (s *SendFileTask) sendMirror(session *core.Session) error {
+	files, err := s.walk(session.Ctx)
+	if err != nil {
+		return err
+	}
+	msg := message.NewMirrorMessage(files, s.Path, s.DstPath, session.Branch, s.Exclude, s.Compress)
+	msg.Signer = s.authOpt.signer()
+	conn, err := s.tlsOpt.dial(s.IP, s.Port, 0)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = msg.WriteTo(conn); err != nil {
+		return err
+	}
+	deleted, err := msg.ReadDeleted(conn)
+	if err != nil {
+		return err
+	}
+	for _, path := range deleted {
+		session.Report(true, message.SystemMessage, "delete:%s", path)
+	}
+	session.Report(true, message.SystemMessage, "mirror finish: %d files deleted", len(deleted))
+	return nil
+}
+
 //路径生产者
-func (s *SendFileTask) productPath(ctx context.Context, filepipe chan<- string, perr chan<- error) {
+func (s *SendFileTask) productPath(ctx context.Context, filepipe chan<- string, files []string) {
 	go func() {
-		err := filepath.Walk(s.Path, func(path string, f os.FileInfo, err error) error {
-			if isEnd(ctx) {
-				return filePathErr
-			}
-			if f == nil {
-				return err
-			}
-			if f.Mode()&os.ModeSymlink == os.ModeSymlink { //过滤掉link文件
-				return filepath.SkipDir
-			}
-			if f.IsDir() {
-				return nil
-			}
-			//排除不需要的文件
-			for _, ex := range s.Exclude {
-				if strings.Index(path, ex) > -1 {
-					return nil //这里已经是文件了，需要的是忽略，而不是跳过目录
-				}
+		defer close(filepipe)
+		for _, file := range files {
+			select {
+			case filepipe <- file:
+			case <-ctx.Done():
+				return
 			}
-			filepipe <- path
-			return nil
-		})
-		close(filepipe)
-		if err != nil {
-			perr <- err
 		}
 	}()
 }
 
-//路径消费者
-func (s *SendFileTask) consumerPath(cancel context.CancelFunc, cerr chan<- error, branch string) chan<- string {
-	var filepipe = make(chan string, maxUpload)
+//walk 遍历需要上传的文件
+func (s *SendFileTask) walk(ctx context.Context) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(s.Path, func(path string, f os.FileInfo, err error) error {
+		if isEnd(ctx) {
+			return filePathErr
+		}
+		if f == nil {
+			return err
+		}
+		if f.Mode()&os.ModeSymlink == os.ModeSymlink { //过滤掉link文件
+			return filepath.SkipDir
+		}
+		if f.IsDir() {
+			return nil
+		}
+		//排除不需要的文件
+		for _, ex := range s.Exclude {
+			if strings.Index(path, ex) > -1 {
+				return nil //这里已经是文件了，需要的是忽略，而不是跳过目录
+			}
+		}
+		files = append(files, path)
+		return nil
+	})
+	return files, err
+}
+
+//sendManifest 发送文件清单，返回服务器需要的文件
+func (s *SendFileTask) sendManifest(session *core.Session, files []string) ([]string, error) {
+	msg, err := message.NewManifestMessage(files, s.Path, s.DstPath, session.Branch, s.Compress)
+	if err != nil {
+		return nil, err
+	}
+	msg.Signer = s.authOpt.signer()
+	conn, err := s.tlsOpt.dial(s.IP, s.Port, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err = msg.WriteTo(conn); err != nil {
+		return nil, err
+	}
+	need, err := msg.ReadNeed(conn)
+	if err != nil {
+		return nil, err
+	}
+	session.Report(true, message.SystemMessage, "manifest: %d files, %d need upload", len(files), len(need))
+	return need, nil
+}
+
+//路径消费者；check为true时上传之前逐个对比md5
+func (s *SendFileTask) consumerPath(cancel context.CancelFunc, cerr chan<- error, check bool, session *core.Session) chan<- string {
+	var filepipe = make(chan string, s.Parallel)
 	go func() {
 		var wait sync.WaitGroup
-		wait.Add(maxUpload)
-		for i := 0; i < maxUpload; i++ {
+		wait.Add(s.Parallel)
+		for i := 0; i < s.Parallel; i++ {
 			go func() {
 				defer wait.Done()
-				for file := range filepipe {
-					err := s.upload(file, branch)
-					if err != nil {
-						if operr, ok := err.(*net.OpError); ok {
-							fmt.Printf("客户端上传错误:%v\n", operr)
-							continue
-						}
-						cerr <- err
-						cancel()
-						return
-					}
+				if err := s.upload(filepipe, check, session); err != nil {
+					session.Logf("客户端上传错误:%v", err)
+					cerr <- err
+					cancel()
 				}
 			}()
 		}
@@ -167,52 +326,168 @@ func (s *SendFileTask) consumerPath(cancel context.CancelFunc, cerr chan<- error
 	return filepipe
 }
 
-//upload 上传文件
-func (s *SendFileTask) upload(file, branch string) error {
-	conn, err := net.Dial("tcp", s.IP+":"+s.Port)
+//upload 通过一个长连接上传文件，直到没有需要上传的文件；网络错误时重新连接，继续上传没有确认的文件
+func (s *SendFileTask) upload(filepipe <-chan string, check bool, session *core.Session) error {
+	var (
+		conn  *uploadConn
+		retry []string //需要重新上传的文件
+		tries int      //已经重试的次数
+		err   error
+	)
+	for {
+		var file string
+		if len(retry) > 0 {
+			file, retry = retry[0], retry[1:]
+		} else if f, ok := <-filepipe; ok {
+			file = f
+		} else if conn == nil {
+			return nil
+		} else if err = conn.close(); err == nil {
+			return nil
+		} else { //没有确认的文件需要重新上传
+			retry, conn = conn.unconfirmed(), nil
+			if !retryable(err) || tries >= s.Retry || len(retry) == 0 {
+				return err
+			}
+			tries++
+			s.waitRetry(session, tries, err)
+			continue
+		}
+		if conn == nil { //有文件需要上传时才建立连接
+			conn, err = s.openUploadConn(session)
+		}
+		if err == nil {
+			err = s.sendFile(conn, file, session.Branch, check)
+		}
+		if err == nil {
+			continue
+		}
+		unconfirmed := []string{file}
+		if conn != nil {
+			unconfirmed = mergeFiles(conn.abort(), file)
+			conn = nil
+		}
+		if !retryable(err) || tries >= s.Retry {
+			return err
+		}
+		tries++
+		s.waitRetry(session, tries, err)
+		retry = append(unconfirmed, retry...)
+	}
+}
+
+//waitRetry 重试之前等待一段时间
+func (s *SendFileTask) waitRetry(session *core.Session, tries int, err error) {
+	session.Logf("upload err:%v; retry:%d/%d", err, tries, s.Retry)
+	time.Sleep(time.Duration(tries) * time.Second)
+}
+
+//sendFile 发送一个文件；check为true时先查询服务器的文件md5，一致时不发送；服务器存在旧文件时只发送差异，大文件分块发送
+func (s *SendFileTask) sendFile(conn *uploadConn, file, branch string, check bool) error {
+	info, err := os.Stat(file)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	if check {
+		if same, err := s.sameFile(conn, file, branch); same || err != nil {
+			return err
+		}
+	}
+	if s.DeltaMin >= 0 && info.Size() > 0 && info.Size() >= s.DeltaMin {
+		if sent, err := s.sendDelta(conn, file, branch); sent || err != nil {
+			return err
+		}
+	}
+	if s.ChunkThreshold >= 0 && info.Size() > 0 && info.Size() >= s.ChunkThreshold {
+		return s.sendChunks(conn, file, branch)
+	}
 	msg, err := message.NewFileMessage(file, s.Path, s.DstPath, branch, s.Compress)
-	defer msg.Close()
 	if err != nil {
 		return err
 	}
-	_, err = msg.WriteTo(conn)
+	defer msg.Close()
+	msg.Seq = nextSeq()
+	return conn.send(msg, msg.Seq, &pendingFrame{file: file, last: true})
+}
+
+//sameFile 查询服务器的文件md5是否与本地一致(只有权限不一致时服务器修改权限)
+func (s *SendFileTask) sameFile(conn *uploadConn, file, branch string) (bool, error) {
+	query, err := message.NewFileMessage(file, s.Path, s.DstPath, branch, false)
+	if err != nil {
+		return false, err
+	}
+	defer query.Close()
+	query.Query = true
+	query.Seq = nextSeq()
+	ack, err := conn.request(query, query.Seq, file)
+	if err != nil {
+		return false, err
+	}
+	return ack.Content == "same", nil
+}
+
+//sendDelta 查询服务器旧文件的签名，只发送差异；服务器没有旧文件或者差异不比原文件小时返回false
+func (s *SendFileTask) sendDelta(conn *uploadConn, file, branch string) (bool, error) {
+	query, err := message.NewDeltaQuery(file, s.Path, s.DstPath, branch)
+	if err != nil {
+		return false, err
+	}
+	query.Seq = nextSeq()
+	ack, err := conn.request(query, query.Seq, file)
+	if err != nil || len(ack.Content) == 0 {
+		return false, err
+	}
+	delta, ok, err := query.Delta(ack.Content, s.Compress)
+	if !ok || err != nil {
+		return false, err
+	}
+	defer delta.Close()
+	conn.logf("delta upload:%s;%d/%d", file, delta.Length, delta.Size)
+	delta.Seq = nextSeq()
+	return true, conn.send(delta, delta.Seq, &pendingFrame{file: file, last: true})
+}
+
+//sendChunks 查询服务器已经确认的偏移量，从该位置开始分块发送文件
+func (s *SendFileTask) sendChunks(conn *uploadConn, file, branch string) error {
+	query, err := message.NewChunkQuery(file, s.Path, s.DstPath, branch)
 	if err != nil {
 		return err
 	}
-	resp, err := message.NewResponse().ParseForm(conn)
+	query.Seq = nextSeq()
+	ack, err := conn.request(query, query.Seq, file)
 	if err != nil {
 		return err
 	}
-	if resp.Success {
-		if resp.Content == "ok" {
-			return nil
-		}
-		//需要上传文件
-		_, err = msg.SendFile(conn)
+	offset, err := strconv.ParseInt(ack.Content, 10, 64)
+	if err != nil {
+		return fmt.Errorf("upload:%s;offset err:%s", file, ack.Content)
+	}
+	if offset > 0 {
+		conn.logf("resume upload:%s;offset:%d", file, offset)
+	}
+	for ; offset < query.Size; offset += s.ChunkSize {
+		chunk, err := query.Chunk(offset, s.ChunkSize, s.Compress)
 		if err != nil {
 			return err
 		}
-		resp, err = message.NewResponse().ParseForm(conn)
+		chunk.Seq = nextSeq()
+		err = conn.send(chunk, chunk.Seq, &pendingFrame{file: file, last: offset+chunk.Raw >= query.Size})
+		chunk.Close()
 		if err != nil {
 			return err
 		}
-		if resp.Success {
-			fmt.Printf("end upload:%s\n", file)
-		} else {
-			fmt.Printf("upload:%s;err:%s\n", file, resp.Content)
-			return fmt.Errorf(resp.Content)
-		}
-	} else {
-		fmt.Printf("upload:%s;err:%s\n", file, resp.Content)
-		return fmt.Errorf(resp.Content)
 	}
 	return nil
 }
 
+//mergeFiles 合并文件列表，去掉重复的文件
+func mergeFiles(files []string, file string) []string {
+	if util.IndexOf(files, file) == -1 {
+		files = append(files, file)
+	}
+	return files
+}
+
 //isEnd 是否结束
 func isEnd(ctx context.Context) bool {
 	select {
@@ -0,0 +1,92 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+
+	"kite/src/task/core"
+	"kite/src/util"
+)
+
+//ShellCondition shell命令的退出码是否等于ExitCode的条件；退出码保存到变量${exitCode}
+type ShellCondition struct {
+	Cmd      string
+	Args     []string
+	ExitCode int //期望的退出码，默认0
+}
+
+//检查是否实现IConditions接口
+var _ core.IConditions = (*ShellCondition)(nil)
+
+func init() {
+	util.RegisterType((*ShellCondition)(nil))
+}
+
+//Init 数据初始化
+func (c *ShellCondition) Init(data map[string]interface{}) error {
+	var ok bool
+	if c.Cmd, ok = data["Cmd"].(string); !ok {
+		return fmt.Errorf("ShellCondition Cmd type error")
+	}
+	args, ok := data["Args"].([]interface{})
+	if !ok {
+		return fmt.Errorf("ShellCondition Args type error")
+	}
+	for _, a := range args {
+		arg, ok := a.(string)
+		if !ok {
+			return fmt.Errorf("ShellCondition Args type error")
+		}
+		c.Args = append(c.Args, arg)
+	}
+	if code, ok := data["ExitCode"]; ok {
+		ii, ok := code.(float64)
+		if !ok {
+			return fmt.Errorf("ShellCondition ExitCode type error")
+		}
+		c.ExitCode = int(ii)
+	}
+	return nil
+}
+
+//ToMap 数据转换为map
+func (c *ShellCondition) ToMap() map[string]interface{} {
+	data := make(map[string]interface{})
+	data["Cmd"] = c.Cmd
+	data["Args"] = c.Args
+	data["ExitCode"] = c.ExitCode
+	return data
+}
+
+//Eval 执行命令，检查退出码，满足时返回true
+func (c *ShellCondition) Eval(session *core.Session) (bool, error) {
+	args := []string{"-c"}
+	for _, a := range c.Args {
+		arg, err := session.Expand(a)
+		if err != nil {
+			return false, err
+		}
+		args = append(args, arg)
+	}
+	if session.IsCancel() {
+		return false, core.ErrCANCEL
+	}
+	code := 0
+	if err := exec.CommandContext(session.Ctx, c.Cmd, args...).Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) { //命令没有执行
+			return false, err
+		}
+		code = exitErr.ExitCode()
+	}
+	session.SetVar("exitCode", strconv.Itoa(code))
+	return code == c.ExitCode, nil
+}
+
+//Run 单独执行时只计算条件，结果由IfElse等通过Eval获取
+func (c *ShellCondition) Run(session *core.Session) error {
+	_, err := c.Eval(session)
+	return err
+}
@@ -2,8 +2,10 @@ package task
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os/exec"
+	"strconv"
 
 	"kite/src/task/core"
 	"kite/src/task/message"
@@ -12,8 +14,9 @@ import (
 
 //ShellTask shell任务
 type ShellTask struct {
-	Cmd  string
-	Args []string
+	Cmd       string
+	Args      []string
+	outputOpt outputOption //捕获输出的配置(Output、Regexp、JSONPath)
 }
 
 //检查是否实现ITask接口
@@ -32,7 +35,7 @@ func (s *ShellTask) Init(data map[string]interface{}) error {
 	for _, a := range args {
 		s.Args = append(s.Args, a.(string))
 	}
-	return nil
+	return s.outputOpt.Init(data)
 }
 
 //ToMap 数据转换为map
@@ -40,6 +43,7 @@ func (s *ShellTask) ToMap() map[string]interface{} {
 	data := make(map[string]interface{})
 	data["Cmd"] = s.Cmd
 	data["Args"] = s.Args
+	s.outputOpt.toMap(data)
 	return data
 }
 
@@ -48,8 +52,11 @@ func (s *ShellTask) Run(session *core.Session) error {
 	args := make([]string, len(s.Args)+1)
 	args[0] = "-c"
 	copy(args[1:], s.Args)
-	for i, a := range args { //替换环境变量
-		args[i] = session.ReplaceEnvVar(a)
+	for i, a := range args { //替换变量
+		var err error
+		if args[i], err = session.Expand(a); err != nil {
+			return err
+		}
 	}
 	cmd := exec.Command(s.Cmd, args...)
 	if session.IsCancel() {
@@ -62,6 +69,18 @@ func (s *ShellTask) Run(session *core.Session) error {
 	cmd.Stdout = &out
 	cmd.Stderr = &errOut
 	err := cmd.Run()
+	code := 0
+	if err != nil {
+		code = -1 //命令没有执行
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		}
+	}
+	session.SetVar("exitCode", strconv.Itoa(code)) //最后一个命令的退出码
+	if cerr := s.outputOpt.capture(session, out.Bytes(), code); cerr != nil && err == nil {
+		return cerr
+	}
 	if err != nil {
 		return fmt.Errorf("err:%v; info:%s", err, errOut.Bytes())
 	}
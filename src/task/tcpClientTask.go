@@ -4,9 +4,8 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"net"
+	"net/url"
 	"os"
-	"time"
 
 	"kite/src/task/core"
 	"kite/src/task/message"
@@ -23,6 +22,10 @@ type TCPClientTask struct {
 	Timeout int
 	//Content 发送内容
 	Content string
+	//tlsOpt tls配置
+	tlsOpt tlsOption
+	//authOpt 签名配置
+	authOpt authOption
 }
 
 //检查是否实现ITask接口
@@ -45,7 +48,10 @@ func (t *TCPClientTask) Init(data map[string]interface{}) error {
 	} else {
 		return fmt.Errorf("TCPClientTask Content type error")
 	}
-	return nil
+	if err := t.authOpt.Init(data); err != nil {
+		return err
+	}
+	return t.tlsOpt.Init(data)
 }
 
 //ToMap 转换为map
@@ -55,20 +61,29 @@ func (t *TCPClientTask) ToMap() map[string]interface{} {
 	data["Port"] = t.Port
 	data["Content"] = t.Content
 	data["Timeout"] = t.Timeout
+	t.tlsOpt.toMap(data)
+	t.authOpt.toMap(data)
 	return data
 }
 
 //Run 执行任务
 func (t *TCPClientTask) Run(session *core.Session) error {
-	conn, err := net.DialTimeout("tcp", t.IP+":"+t.Port, time.Millisecond*time.Duration(t.Timeout))
+	conn, err := t.tlsOpt.dial(t.IP, t.Port, t.Timeout)
 	if err != nil {
-		return err
+		return core.WithCode(message.CodeConn, err)
 	}
 	defer conn.Close()
 	if session.IsCancel() {
 		return core.ErrCANCEL
 	}
 	msg := message.NewCmdMessage(t.Content, session.Branch) //创建消息
+	msg.Params = holderParams(session)
+	session.Meta.Params(msg.Params)     //分支描述信息，创建与更新分支时保存
+	varParams(session.Vars, msg.Params) //--var传入的参数，服务端的ParamTask校验
+	for key, vals := range session.Params {
+		msg.Params[key] = vals
+	}
+	msg.Signer = t.authOpt.signer()
 	_, err = session.Request().Send(conn, msg)
 	if err != nil {
 		return err
@@ -83,20 +98,40 @@ func (t *TCPClientTask) Run(session *core.Session) error {
 			if err != io.EOF { //请求出错，且没有结束，直接返回错误
 				return err
 			}
-			if Msg == nil || len(Msg.Content) == 0 { //读取结束，且没有数据直接返回
-				return nil
+			if Msg == nil || len(Msg.Content) == 0 { //没有收到执行结果连接就已经断开，命令可能只执行了一部分
+				return core.WithCode(message.CodeConn, io.ErrUnexpectedEOF)
 			}
 		}
+		if session.OnMessage != nil {
+			session.OnMessage(Msg)
+		}
 		if !Msg.Success {
-			return fmt.Errorf("%s", Msg.Content)
+			return core.MessageError(Msg)
 		}
-		if Msg.Type == message.BusinessMessage {
-			fmt.Fprintf(session, "%s\n", Msg.Content)
-		} else {
-			//todo 系统消息怎么处理? 系统消息暂时不显示
-			fmt.Fprintf(os.Stderr, "%s\n", Msg.Content)
+		if session.OnMessage == nil {
+			if Msg.Type == message.BusinessMessage {
+				fmt.Fprintf(session, "%s\n", Msg.Content)
+			} else {
+				//todo 系统消息怎么处理? 系统消息暂时不显示
+				fmt.Fprintf(os.Stderr, "%s\n", Msg.Content)
+			}
 		}
+		if Msg.End { //执行结果是最后一条消息
+			return nil
+		}
+	}
+}
+
+//holderParams 锁的持有者参数，服务端用于获取、续期与释放锁
+func holderParams(session *core.Session) url.Values {
+	params := url.Values{}
+	if len(session.Holder) > 0 {
+		params.Set("holder", session.Holder)
+	}
+	if session.Force {
+		params.Set("force", "true")
 	}
+	return params
 }
 
 func init() {
@@ -1,10 +1,13 @@
 package task
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"strconv"
+	"time"
 
 	"kite/src/task/core"
 	"kite/src/task/message"
@@ -15,6 +18,16 @@ import (
 type TCPServerTask struct {
 	Port     string
 	TaskDict core.Map
+	tlsOpt   tlsOption //tls配置(CertFile、KeyFile、CAFile)
+	//AuthKeys 客户端的key id => 共享密钥；不为空时所有请求都必须签名
+	AuthKeys map[string]string
+	//AuthWindow 签名允许的时间误差(单位：s)，默认300
+	AuthWindow int
+	//ReapInterval 检查过期分支的间隔(单位：s)，默认300；0表示不检查
+	ReapInterval int
+	//ReapCmd 删除过期分支时执行的TaskDict命令，默认delete
+	ReapCmd  string
+	verifier *message.Verifier
 }
 
 //检查是否实现ITask接口
@@ -26,6 +39,42 @@ func (t *TCPServerTask) Init(data map[string]interface{}) error {
 	if t.Port, ok = data["Port"].(string); !ok {
 		return fmt.Errorf("TCPServerTask Port type error")
 	}
+	if err := t.tlsOpt.Init(data); err != nil {
+		return err
+	}
+	if keys, ok := data["AuthKeys"]; ok {
+		dict, ok := keys.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("TCPServerTask AuthKeys type error")
+		}
+		t.AuthKeys = make(map[string]string)
+		for k, v := range dict {
+			if t.AuthKeys[k], ok = v.(string); !ok {
+				return fmt.Errorf("TCPServerTask AuthKeys type error")
+			}
+		}
+	}
+	if window, ok := data["AuthWindow"]; ok {
+		ii, ok := window.(float64)
+		if !ok {
+			return fmt.Errorf("TCPServerTask AuthWindow type error")
+		}
+		t.AuthWindow = int(ii)
+	}
+	t.ReapInterval = defaultReapInterval
+	if interval, ok := data["ReapInterval"]; ok {
+		ii, ok := interval.(float64)
+		if !ok || ii < 0 {
+			return fmt.Errorf("TCPServerTask ReapInterval type error")
+		}
+		t.ReapInterval = int(ii)
+	}
+	t.ReapCmd = defaultReapCmd
+	if cmd, ok := data["ReapCmd"]; ok {
+		if t.ReapCmd, ok = cmd.(string); !ok {
+			return fmt.Errorf("TCPServerTask ReapCmd type error")
+		}
+	}
 	t.TaskDict = core.NewMap()
 	if dict, ok := data["TaskDict"].(map[string]interface{}); ok {
 		return t.TaskDict.Init(dict)
@@ -38,16 +87,34 @@ func (t *TCPServerTask) ToMap() map[string]interface{} {
 	data := make(map[string]interface{})
 	data["Port"] = t.Port
 	data["TaskDict"] = t.TaskDict.ToMap()
+	t.tlsOpt.toMap(data)
+	if len(t.AuthKeys) > 0 {
+		data["AuthKeys"] = t.AuthKeys
+		data["AuthWindow"] = t.AuthWindow
+	}
+	data["ReapInterval"] = t.ReapInterval
+	data["ReapCmd"] = t.ReapCmd
 	return data
 }
 
 //Run 监听端口号，接收请求，然后根据指令执行任务；将任务的结果输出给客户端
 func (t *TCPServerTask) Run(session *core.Session) error {
-	listen, err := net.Listen("tcp", ":"+t.Port)
+	cfg, err := t.tlsOpt.serverConfig()
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	listen, err := util.Listen(":"+t.Port, cfg)
 	if err != nil {
 		log.Print(err)
 		return err
 	}
+	if len(t.AuthKeys) > 0 {
+		t.verifier = message.NewVerifier(t.AuthKeys, time.Second*time.Duration(t.AuthWindow))
+	}
+	if t.ReapInterval > 0 { //定时删除过期的分支
+		go t.reap(session)
+	}
 	for {
 		if session.IsCancel() {
 			return core.ErrCANCEL
@@ -75,24 +142,72 @@ func (t *TCPServerTask) handleConn(session *core.Session, conn net.Conn) {
 		return
 	}
 	session.Request().SetAddr(conn.RemoteAddr())
+	if t.verifier != nil { //校验签名
+		if err := t.verifier.Verify(session.Request()); err != nil {
+			log.Printf("%s; addr:%s\n", err, conn.RemoteAddr())
+			printFail(session, message.CodeAuth, "%v", err)
+			return
+		}
+		session.Request().SetFrames(t.verifier.Frames(session.Request())) //长连接中后续的请求也必须签名
+	}
 	cmd := session.Request().Cmd()
+	session.TaskName = cmd
 	session.Branch = session.Request().Branch()
+	session.Holder = session.Request().Get("holder")
+	if len(session.Holder) == 0 { //旧的客户端没有持有者，使用ip区分
+		session.Holder = "anonymous@" + session.Request().RemoteAddr()
+	}
+	session.Holder = core.BindHolder(session.Holder, t.identity(session.Request(), conn))
+	session.Force, _ = strconv.ParseBool(session.Request().Get("force"))
+	session.Meta = core.ParseBranchMeta(session.Request().Get)
+	session.Vars = parseVars(session.Request().Query())
+	if len(session.Meta.Owner) == 0 { //没有提交负责人时使用持有者
+		session.Meta.Owner = core.HolderName(session.Holder)
+	}
+	session.BMan.Renew(session.Branch, session.Holder, cmd) //持有者执行命令时续期
+	defer session.BMan.Renew(session.Branch, session.Holder, "")
 	if task, ok := t.TaskDict[cmd]; ok {
-		err := task.Run(session)
-		if err != nil {
+		session.Vars = declaredVars(cmd, task, session.Vars)
+		if err := task.Run(session); err != nil {
 			log.Print(err)
-			session.Printf(false, message.SystemMessage, "method：%s; execute fail:%v", cmd, err)
+			if _, ok := session.GetCurBranchEntity(); ok { //记录分支最后一次命令的结果
+				session.BMan.UpdateBranch(session.Branch, func(b *core.Branch) { b.LastResult = core.NewCmdResult(cmd, err) })
+			}
+			printFail(session, core.ErrorCode(err), "method：%s; execute fail:%v", cmd, err)
 			return
 		}
 		log.Printf("method：%s; execute success\n", cmd)
 		//执行成功
-		session.Printf(true, message.SystemMessage, "method：%s; execute success", cmd)
+		msg := message.NewMessage(true, message.SystemMessage, fmt.Sprintf("method：%s; execute success", cmd))
+		msg.End = true
+		session.Response().Write(session, msg)
 	} else {
 		log.Printf("method：%s; not fount\n", cmd)
-		session.Printf(false, message.SystemMessage, "method：%s; not fount", cmd)
+		printFail(session, message.CodeConfig, "method：%s; not fount", cmd)
 	}
 }
 
+//identity 校验过的客户端身份：签名的key id，或者双向认证时客户端证书的名称；都没有时返回空
+func (t *TCPServerTask) identity(req *message.Request, conn net.Conn) string {
+	if t.verifier != nil {
+		return "key:" + req.Get("key")
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		if state := tc.ConnectionState(); len(state.VerifiedChains) > 0 {
+			return "cert:" + state.PeerCertificates[0].Subject.CommonName
+		}
+	}
+	return ""
+}
+
+//printFail 输出失败消息，带上失败的分类；失败消息是命令的最后一条消息
+func printFail(session *core.Session, code message.Code, format string, a ...interface{}) {
+	msg := message.NewMessage(false, message.SystemMessage, fmt.Sprintf(format, a...))
+	msg.Code = code
+	msg.End = true
+	session.Response().Write(session, msg)
+}
+
 func init() {
 	util.RegisterType((*TCPServerTask)(nil))
 }
@@ -0,0 +1,100 @@
+package task
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"kite/src/util"
+)
+
+//tlsOption tls的配置项；服务端与客户端的任务共用
+type tlsOption struct {
+	TLS        bool   //客户端是否启用tls(配置了CAFile时自动启用)
+	CertFile   string //证书路径(服务端必填；客户端选填，用于双向认证)
+	KeyFile    string //私钥路径
+	CAFile     string //CA证书(客户端：校验服务端证书；服务端：校验客户端证书)
+	ServerName string //服务端证书的名称(客户端使用，默认为连接的ip)
+
+	once   sync.Once
+	config *tls.Config
+	err    error
+}
+
+//Init 数据初始化，所有字段都是选填
+func (o *tlsOption) Init(data map[string]interface{}) error {
+	if val, ok := data["TLS"]; ok {
+		ii, ok := val.(float64)
+		if !ok {
+			return fmt.Errorf("TLS type error: require:(int);actual:(%T)", val)
+		}
+		o.TLS = ii == float64(1)
+	}
+	for key, field := range map[string]*string{
+		"CertFile":   &o.CertFile,
+		"KeyFile":    &o.KeyFile,
+		"CAFile":     &o.CAFile,
+		"ServerName": &o.ServerName,
+	} {
+		if val, ok := data[key]; ok {
+			if *field, ok = val.(string); !ok {
+				return fmt.Errorf("TLS %s type error", key)
+			}
+		}
+	}
+	return nil
+}
+
+//toMap 将配置写入map
+func (o *tlsOption) toMap(data map[string]interface{}) {
+	if o.TLS {
+		data["TLS"] = 1
+	}
+	for key, val := range map[string]string{
+		"CertFile":   o.CertFile,
+		"KeyFile":    o.KeyFile,
+		"CAFile":     o.CAFile,
+		"ServerName": o.ServerName,
+	} {
+		if len(val) > 0 {
+			data[key] = val
+		}
+	}
+}
+
+//serverConfig 服务端的tls配置；没有配置证书时返回nil
+func (o *tlsOption) serverConfig() (*tls.Config, error) {
+	if len(o.CertFile) == 0 {
+		return nil, nil
+	}
+	o.once.Do(func() {
+		o.config, o.err = util.NewServerTLSConfig(o.CertFile, o.KeyFile, o.CAFile)
+	})
+	return o.config, o.err
+}
+
+//clientConfig 客户端的tls配置；没有启用tls时返回nil
+func (o *tlsOption) clientConfig(ip string) (*tls.Config, error) {
+	if !o.TLS && len(o.CAFile) == 0 {
+		return nil, nil
+	}
+	o.once.Do(func() {
+		name := o.ServerName
+		if len(name) == 0 {
+			name = ip
+		}
+		o.config, o.err = util.NewClientTLSConfig(o.CAFile, name, o.CertFile, o.KeyFile)
+	})
+	return o.config, o.err
+}
+
+//dial 根据配置建立连接(tcp或tls)
+func (o *tlsOption) dial(ip, port string, timeout int) (net.Conn, error) {
+	cfg, err := o.clientConfig(ip)
+	if err != nil {
+		return nil, err
+	}
+	return util.DialTimeout(ip+":"+port, time.Millisecond*time.Duration(timeout), cfg)
+}
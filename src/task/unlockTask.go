@@ -5,8 +5,11 @@ import (
 	"kite/src/util"
 )
 
-//UnlockTask 删除分支的任务
-type UnlockTask struct{}
+//UnlockTask 释放分支锁的任务
+type UnlockTask struct {
+	//Global 释放全局锁；默认只释放当前分支的锁
+	Global bool
+}
 
 //检查是否实现ITask接口
 var _ core.ITask = (*UnlockTask)(nil)
@@ -17,16 +20,22 @@ func init() {
 
 //Init 数据初始化
 func (c *UnlockTask) Init(data map[string]interface{}) error {
+	c.Global, _ = data["Global"].(bool)
 	return nil
 }
 
 //ToMap 数据转换为map
 func (c *UnlockTask) ToMap() map[string]interface{} {
-	return make(map[string]interface{})
+	data := make(map[string]interface{})
+	data["Global"] = c.Global
+	return data
 }
 
 //Run 释放锁
 func (c *UnlockTask) Run(session *core.Session) error {
-	session.BMan.Unlock()
-	return nil
+	branch, err := lockName(session, c.Global)
+	if err != nil {
+		return err
+	}
+	return session.BMan.Unlock(branch, session.Holder, session.Force)
 }
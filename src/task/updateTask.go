@@ -6,11 +6,15 @@ import (
 	"time"
 
 	"kite/src/task/core"
+	"kite/src/task/message"
 	"kite/src/util"
 )
 
 //UpdateTask 更新分支的任务
-type UpdateTask struct{}
+type UpdateTask struct {
+	//Keep 启用发布目录时保留的发布数量(包括当前的发布)，默认5
+	Keep int
+}
 
 //检查是否实现ITask接口
 var _ core.ITask = (*UpdateTask)(nil)
@@ -21,23 +25,38 @@ func init() {
 
 //Init 数据初始化
 func (c *UpdateTask) Init(data map[string]interface{}) error {
+	c.Keep = defaultKeepReleases
+	if keep, ok := data["Keep"]; ok {
+		ii, ok := keep.(float64)
+		if !ok || ii < 1 {
+			return fmt.Errorf("UpdateTask Keep type error")
+		}
+		c.Keep = int(ii)
+	}
 	return nil
 }
 
 //ToMap 数据转换为map
 func (c *UpdateTask) ToMap() map[string]interface{} {
-	return make(map[string]interface{})
+	data := make(map[string]interface{})
+	data["Keep"] = c.Keep
+	return data
 }
 
 //Run 更新分支
 func (c *UpdateTask) Run(session *core.Session) error {
-	defer session.BMan.Unlock() //解锁
-	b, ok := session.GetCurBranchEntity()
-	if !ok {
-		return fmt.Errorf("branch:%s not exist", session.Branch)
-	}
-	b.Version++
-	b.Time = time.Now().Format("2006-01-02 15:04:05")
-	b.Path = filepath.Join(session.WorkSpace, session.Branch)
-	return session.BMan.Save()
+	defer session.BMan.Unlock(session.Branch, session.Holder, false) //解锁
+	return session.BMan.Tx(func(tx *core.BranchTx) error {
+		b, ok := tx.GetBranch(session.Branch)
+		if !ok {
+			return core.WithCode(message.CodeNotExist, fmt.Errorf("branch:%s not exist", session.Branch))
+		}
+		b.Version++
+		b.Time = time.Now().Format(core.TimeLayout)
+		b.LastUsed = b.Time
+		b.Path = filepath.Join(session.WorkSpace, session.Branch)
+		b.Merge(session.Meta)
+		b.LastResult = core.NewCmdResult(session.Request().Cmd(), nil)
+		return publishRelease(session, b, c.Keep) //切换到本次上传的发布目录
+	})
 }
@@ -0,0 +1,237 @@
+package task
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"kite/src/task/core"
+	"kite/src/task/message"
+)
+
+//uploadSeq 上传文件的序号
+var uploadSeq int64
+
+//uploadFrame 长连接中发送的一个文件或文件块
+type uploadFrame interface {
+	io.WriterTo
+	SendFile(w io.Writer) (int64, error)
+}
+
+//ackError 服务端确认失败的错误，重试也无法成功
+type ackError struct {
+	file    string
+	content string
+}
+
+func (e *ackError) Error() string {
+	return fmt.Sprintf("upload:%s;err:%s", e.file, e.content)
+}
+
+//retryable 错误是否可以通过重新建立连接重试
+func retryable(err error) bool {
+	var ack *ackError
+	return err != nil && !errors.As(err, &ack)
+}
+
+//pendingFrame 等待确认的文件或文件块
+type pendingFrame struct {
+	file  string                //本地路径
+	last  bool                  //是否是文件的最后一块，确认之后文件上传完成
+	reply chan *message.Message //不为空时将确认消息返回给调用方
+}
+
+//uploadConn 上传文件的长连接；一个连接连续发送多个文件，服务端按序号逐个确认
+type uploadConn struct {
+	conn    net.Conn
+	writer  *bufio.Writer
+	mu      sync.Mutex
+	pending map[int]*pendingFrame        //等待确认的文件：序号 => 文件
+	frames  *message.FrameSigner         //后续请求的签名器；为空表示不签名
+	logf    func(string, ...interface{}) //输出上传进度
+	err     error                        //第一个错误
+	done    chan struct{}                //读取确认结束
+}
+
+//openUploadConn 建立上传文件的长连接
+func (s *SendFileTask) openUploadConn(session *core.Session) (*uploadConn, error) {
+	conn, err := s.tlsOpt.dial(s.IP, s.Port, 0)
+	if err != nil {
+		return nil, core.WithCode(message.CodeConn, err)
+	}
+	msg := message.NewCmdMessage("upload", session.Branch)
+	msg.Params = holderParams(session)
+	msg.Params.Set("op", "stream")
+	msg.Signer = s.authOpt.signer()
+	c := &uploadConn{
+		conn:    conn,
+		writer:  bufio.NewWriter(conn),
+		pending: make(map[int]*pendingFrame),
+		done:    make(chan struct{}),
+		logf:    session.Logf,
+	}
+	var line bytes.Buffer
+	msg.WriteTo(&line)
+	if msg.Signer != nil { //后续的请求使用连接请求的签名继续签名
+		c.frames = msg.Signer.Frames(strings.TrimSpace(line.String()))
+	}
+	if _, err = line.WriteTo(c.writer); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+//nextSeq 获取下一个序号
+func nextSeq() int {
+	return int(atomic.AddInt64(&uploadSeq, 1))
+}
+
+//send 发送一个文件或文件块，不等待确认
+func (c *uploadConn) send(frame uploadFrame, seq int, pending *pendingFrame) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.pending[seq] = pending
+	c.mu.Unlock()
+	if err := c.writeLine(frame); err != nil {
+		return err
+	}
+	_, err := frame.SendFile(c.writer)
+	return err
+}
+
+//writeLine 写入请求行；连接请求签名时后续的请求行也需要签名
+func (c *uploadConn) writeLine(frame io.WriterTo) error {
+	if c.frames == nil {
+		_, err := frame.WriteTo(c.writer)
+		return err
+	}
+	var line bytes.Buffer
+	if _, err := frame.WriteTo(&line); err != nil {
+		return err
+	}
+	_, err := io.WriteString(c.writer, c.frames.Sign(strings.TrimSpace(line.String()))+"\n")
+	return err
+}
+
+//request 发送请求并等待确认消息
+func (c *uploadConn) request(frame uploadFrame, seq int, file string) (*message.Message, error) {
+	reply := make(chan *message.Message, 1)
+	err := c.send(frame, seq, &pendingFrame{file: file, reply: reply})
+	if err == nil {
+		err = c.writer.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case msg := <-reply:
+		if !msg.Success {
+			return nil, &ackError{file, msg.Content}
+		}
+		return msg, nil
+	case <-c.done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+}
+
+//readLoop 读取服务端的确认消息
+func (c *uploadConn) readLoop() {
+	defer close(c.done)
+	reader := bufio.NewReader(c.conn)
+	for {
+		msg, err := message.ParseMsg(reader)
+		if err != nil {
+			if err != io.EOF {
+				c.fail(err)
+			}
+			return
+		}
+		if msg.Type != message.AckMessage {
+			if !msg.Success {
+				c.fail(core.MessageError(msg))
+			}
+			continue
+		}
+		c.mu.Lock()
+		pending, ok := c.pending[msg.ID]
+		delete(c.pending, msg.ID)
+		c.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if pending.reply != nil {
+			pending.reply <- msg
+		} else if !msg.Success {
+			c.logf("upload:%s;err:%s", pending.file, msg.Content)
+			c.fail(&ackError{pending.file, msg.Content})
+		} else if pending.last {
+			c.logf("end upload:%s", pending.file)
+		}
+	}
+}
+
+//fail 记录第一个错误
+func (c *uploadConn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+//close 通知服务端上传结束，等待所有文件的确认
+func (c *uploadConn) close() error {
+	defer c.conn.Close()
+	err := c.writeLine(strings.NewReader("/upload?op=end\n"))
+	if err == nil {
+		err = c.writer.Flush()
+	}
+	if err != nil {
+		return err
+	}
+	<-c.done
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil && len(c.pending) > 0 {
+		return fmt.Errorf("upload: %d files not confirmed", len(c.pending))
+	}
+	return c.err
+}
+
+//abort 中断连接，返回没有确认的文件
+func (c *uploadConn) abort() []string {
+	c.conn.Close()
+	<-c.done
+	return c.unconfirmed()
+}
+
+//unconfirmed 没有确认的文件
+func (c *uploadConn) unconfirmed() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files := []string{}
+	exists := make(map[string]bool)
+	for _, pending := range c.pending {
+		if !exists[pending.file] {
+			exists[pending.file] = true
+			files = append(files, pending.file)
+		}
+	}
+	return files
+}
@@ -0,0 +1,65 @@
+package task
+
+import (
+	"fmt"
+
+	"kite/src/task/core"
+	"kite/src/util"
+)
+
+//VarCondition 变量比较的条件，例如${env} == prod；变量不存在时为空字符串
+type VarCondition struct {
+	Name  string //变量名称
+	Op    string //运算符：==、!=、=~、!~、>、<、>=、<=，默认==
+	Value string //比较的值，支持变量
+}
+
+//检查是否实现IConditions接口
+var _ core.IConditions = (*VarCondition)(nil)
+
+func init() {
+	util.RegisterType((*VarCondition)(nil))
+}
+
+//Init 数据初始化
+func (c *VarCondition) Init(data map[string]interface{}) error {
+	var ok bool
+	if c.Name, ok = data["Name"].(string); !ok || len(c.Name) == 0 {
+		return fmt.Errorf("VarCondition Name type error")
+	}
+	c.Op = "=="
+	if op, ok := data["Op"]; ok {
+		if c.Op, ok = op.(string); !ok || util.IndexOf(core.CompareOps, c.Op) == -1 {
+			return fmt.Errorf("VarCondition Op type error")
+		}
+	}
+	if c.Value, ok = data["Value"].(string); !ok {
+		return fmt.Errorf("VarCondition Value type error")
+	}
+	return nil
+}
+
+//ToMap 数据转换为map
+func (c *VarCondition) ToMap() map[string]interface{} {
+	data := make(map[string]interface{})
+	data["Name"] = c.Name
+	data["Op"] = c.Op
+	data["Value"] = c.Value
+	return data
+}
+
+//Eval 比较变量，满足时返回true
+func (c *VarCondition) Eval(session *core.Session) (bool, error) {
+	value, err := session.Expand(c.Value)
+	if err != nil {
+		return false, err
+	}
+	val, _ := session.Var(c.Name)
+	return core.Compare(val, c.Op, value)
+}
+
+//Run 单独执行时只计算条件，结果由IfElse等通过Eval获取
+func (c *VarCondition) Run(session *core.Session) error {
+	_, err := c.Eval(session)
+	return err
+}
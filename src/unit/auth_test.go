@@ -0,0 +1,108 @@
+package unit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"kite/src/task/message"
+)
+
+//signedRequest 生成签名之后的请求
+func signedRequest(t *testing.T, keyID, secret string) string {
+	var buf bytes.Buffer
+	msg := message.NewCmdMessage("delete", "test1")
+	msg.Signer = &message.Signer{KeyID: keyID, Secret: secret}
+	if _, err := msg.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+//verify 解析请求并校验签名
+func verify(t *testing.T, v *message.Verifier, line string) error {
+	req := message.NewRequest()
+	if _, err := req.ParseForm(strings.NewReader(line)); err != nil {
+		t.Fatal(err)
+	}
+	return v.Verify(req)
+}
+
+//测试请求签名
+func TestVerify(t *testing.T) {
+	v := message.NewVerifier(map[string]string{"ci": "secret"}, time.Minute)
+	line := signedRequest(t, "ci", "secret")
+	if err := verify(t, v, line); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(t, v, line); err == nil {
+		t.Fatal("replayed request must fail")
+	}
+	tampered := strings.Replace(signedRequest(t, "ci", "secret"), "test1", "test2", 1)
+	if err := verify(t, v, tampered); err == nil {
+		t.Fatal("tampered request must fail")
+	}
+	if err := verify(t, v, signedRequest(t, "ci", "other")); err == nil {
+		t.Fatal("wrong secret must fail")
+	}
+	if err := verify(t, v, signedRequest(t, "dev", "secret")); err == nil {
+		t.Fatal("unknown key must fail")
+	}
+	if err := verify(t, v, "/delete?branch=test1\n"); err == nil {
+		t.Fatal("unsigned request must fail")
+	}
+}
+
+//测试签名之后追加的参数
+func TestVerifyAppended(t *testing.T) {
+	v := message.NewVerifier(map[string]string{"ci": "secret"}, time.Minute)
+	line := strings.TrimSpace(signedRequest(t, "ci", "secret"))
+	if err := verify(t, v, line+"&force=true\n"); err == nil {
+		t.Fatal("params after sign must fail")
+	}
+}
+
+//测试长连接中后续请求的签名
+func TestVerifyFrames(t *testing.T) {
+	v := message.NewVerifier(map[string]string{"ci": "secret"}, time.Minute)
+	signer := &message.Signer{KeyID: "ci", Secret: "secret"}
+	line := strings.TrimSpace(signedRequest(t, "ci", "secret"))
+	req := message.NewRequest()
+	if _, err := req.ParseForm(strings.NewReader(line + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(req); err != nil {
+		t.Fatal(err)
+	}
+	client, server := signer.Frames(line), v.Frames(req)
+	frame1 := client.Sign("/upload?op=offset&path=a.txt&seq=1")
+	frame2 := client.Sign("/upload?op=end")
+	frameReq := func(line string) *message.Request {
+		req := message.NewRequest()
+		if _, err := req.ParseForm(strings.NewReader(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	if err := server.Verify(frameReq(frame2)); err == nil { //顺序错误
+		t.Fatal("reordered frame must fail")
+	}
+	server = v.Frames(req)
+	if err := server.Verify(frameReq(frame1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Verify(frameReq(frame1)); err == nil {
+		t.Fatal("replayed frame must fail")
+	}
+	other := signer.Frames(strings.TrimSpace(signedRequest(t, "ci", "secret")))
+	if err := v.Frames(req).Verify(frameReq(other.Sign("/upload?op=offset&path=a.txt&seq=1"))); err == nil {
+		t.Fatal("frame of other connection must fail")
+	}
+	if err := v.Frames(req).Verify(frameReq(strings.Replace(frame1, "a.txt", "b.txt", 1))); err == nil {
+		t.Fatal("tampered frame must fail")
+	}
+	if err := v.Frames(req).Verify(frameReq("/upload?op=end")); err == nil {
+		t.Fatal("unsigned frame must fail")
+	}
+}
@@ -0,0 +1,251 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kite/src/task"
+	"kite/src/task/core"
+)
+
+//newBranchManager 在临时目录创建分支管理者
+func newBranchManager(t *testing.T) (*core.BranchManager, string) {
+	dir, err := ioutil.TempDir("", "kite-branch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err = ioutil.WriteFile(path, []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bm := core.NewBranchManager(core.NewFileStore(path))
+	if bm == nil {
+		t.Fatal("load config fail")
+	}
+	return bm, dir
+}
+
+func TestBranchTx(t *testing.T) {
+	bm, dir := newBranchManager(t)
+	defer os.RemoveAll(dir)
+	if err := bm.AddBranch("test1", "/ws/test1"); err != nil {
+		t.Fatal(err)
+	}
+	err := bm.Tx(func(tx *core.BranchTx) error {
+		tx.AddBranch("test2", "/ws/test2")
+		tx.DelBranch("test1")
+		return fmt.Errorf("rollback")
+	})
+	if err == nil {
+		t.Fatal("tx error lost")
+	}
+	if _, ok := bm.GetBranch("test1"); !ok {
+		t.Fatal("rollback fail: test1 deleted")
+	}
+	if _, ok := bm.GetBranch("test2"); ok {
+		t.Fatal("rollback fail: test2 added")
+	}
+	b, _ := bm.GetBranch("test1")
+	b.Version = 100 //副本不影响分支信息
+	if b, _ := bm.GetBranch("test1"); b.Version != 1 {
+		t.Fatal("GetBranch returns internal branch")
+	}
+	var wait sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			bm.AddBranch(fmt.Sprintf("b%d", i), "/ws")
+			bm.UpdateBranch("test1", func(b *core.Branch) { b.Version++ })
+			bm.Foreach(func(*core.Branch, int) bool { return true })
+		}(i)
+	}
+	wait.Wait()
+	reload := core.NewBranchManager(bm.Store)
+	if b, _ := reload.GetBranch("test1"); b.Version != 21 || len(reload.Filter(func(*core.Branch, int) bool { return true })) != 21 {
+		t.Fatalf("concurrent update lost: version:%d", b.Version)
+	}
+}
+
+func TestBranchRecovery(t *testing.T) {
+	bm, dir := newBranchManager(t)
+	defer os.RemoveAll(dir)
+	for i := 1; i <= 8; i++ {
+		if err := bm.AddBranch(fmt.Sprintf("test%d", i), "/ws"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "config.json")
+	if _, err := os.Stat(path + ".bak.6"); !os.IsNotExist(err) {
+		t.Fatal("too many backups")
+	}
+	ioutil.WriteFile(path, []byte(`[{"name":"test1"`), 0644) //配置文件损坏
+	ioutil.WriteFile(path+".bak.1", []byte(`{`), 0644)       //最新的备份也损坏
+	reload := core.NewBranchManager(core.NewFileStore(path))
+	if reload == nil {
+		t.Fatal("recovery fail")
+	}
+	list := reload.Filter(func(*core.Branch, int) bool { return true })
+	if len(list) != 6 { //从.bak.2恢复：第6次保存之前的版本
+		t.Fatalf("recovery from wrong backup: %d branches", len(list))
+	}
+	if _, err := os.Stat(path + ".corrupt"); err != nil {
+		t.Fatal("corrupt config not kept")
+	}
+	if core.NewBranchManager(core.NewFileStore(path)) == nil {
+		t.Fatal("recovered config invalid")
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	bm, dir := newBranchManager(t)
+	defer os.RemoveAll(dir)
+	bm.AddBranch("feature/a", "/ws/a")
+	bm.AddBranch("test1", "/ws/test1")
+	store := core.NewDirStore(filepath.Join(dir, "branches"))
+	if n, err := core.MigrateStore(bm.Store, store); err != nil || n != 2 {
+		t.Fatalf("migrate fail:%d,%v", n, err)
+	}
+	if _, err := core.MigrateStore(bm.Store, store); err == nil {
+		t.Fatal("migrate to a store with branches")
+	}
+	dm := core.NewBranchManager(core.NewDirStore(store.Dir))
+	if _, ok := dm.GetBranch("feature/a"); !ok {
+		t.Fatal("branch not migrated")
+	}
+	file := filepath.Join(store.Dir, "test1.json")
+	info, _ := os.Stat(file)
+	dm.UpdateBranch("feature/a", func(b *core.Branch) { b.Version++ })
+	if after, _ := os.Stat(file); !after.ModTime().Equal(info.ModTime()) {
+		t.Fatal("unchanged branch rewritten")
+	}
+	dm.DelBranch("feature/a")
+	if _, err := os.Stat(filepath.Join(store.Dir, "feature%2Fa.json")); !os.IsNotExist(err) {
+		t.Fatal("deleted branch file exists")
+	}
+	dm.UpdateBranch("test1", func(b *core.Branch) { b.Version = 5 })
+	ioutil.WriteFile(file, []byte("{"), 0644) //分支文件损坏，从上一个版本恢复
+	reload := core.NewBranchManager(core.NewDirStore(store.Dir))
+	if b, ok := reload.GetBranch("test1"); !ok || b.Version != 1 {
+		t.Fatal("recovery from branch backup fail")
+	}
+	//中途失败时已经替换与删除的分支文件恢复原状
+	reload.AddBranch("a", "/ws/a")
+	reload.AddBranch("b", "/ws/b")
+	os.MkdirAll(filepath.Join(store.Dir, "c.json", "sub"), 0755) //c的分支文件无法替换
+	before := map[string][]byte{}
+	for _, name := range []string{"a", "b", "test1"} {
+		before[name], _ = ioutil.ReadFile(filepath.Join(store.Dir, name+".json"))
+	}
+	err := reload.Tx(func(tx *core.BranchTx) error {
+		tx.DelBranch("test1")
+		for _, name := range []string{"a", "b"} {
+			b, _ := tx.GetBranch(name)
+			b.Version = 9
+		}
+		tx.AddBranch("c", "/ws/c")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("save with a broken branch file")
+	}
+	for name, data := range before {
+		if after, _ := ioutil.ReadFile(filepath.Join(store.Dir, name+".json")); string(after) != string(data) {
+			t.Fatalf("branch:%s changed after failed save:%s", name, after)
+		}
+	}
+	os.RemoveAll(filepath.Join(store.Dir, "c.json"))
+	if list, err := core.NewDirStore(store.Dir).Load(); err != nil || len(list) != 3 {
+		t.Fatalf("reload after failed save:%d,%v", len(list), err)
+	}
+	//迁移到还没有配置文件的单文件存储
+	fresh := core.NewFileStore(filepath.Join(dir, "fresh", "config.json"))
+	os.MkdirAll(filepath.Join(dir, "fresh"), 0755)
+	if n, err := core.MigrateStore(store, fresh); err != nil || n != 3 {
+		t.Fatalf("migrate to new file store fail:%d,%v", n, err)
+	}
+	if list, err := fresh.Load(); err != nil || len(list) != 3 {
+		t.Fatalf("migrated file store:%d,%v", len(list), err)
+	}
+}
+
+func TestBranchMeta(t *testing.T) {
+	bm, dir := newBranchManager(t)
+	defer os.RemoveAll(dir)
+	meta := core.BranchMeta{Owner: "a@host", Commit: "c1", Desc: "demo", Labels: core.ParseLabels(" qa,api,qa,")}
+	err := bm.Tx(func(tx *core.BranchTx) error {
+		tx.AddBranch("test1", "/ws/test1")
+		b, _ := tx.GetBranch("test1")
+		b.Merge(meta)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := bm.GetBranch("test1")
+	if len(b.Created) == 0 || b.Created != b.Time || strings.Join(b.Labels, ",") != "api,qa" {
+		t.Fatalf("branch meta err:%+v", b)
+	}
+	b.Labels[0] = "changed" //副本不影响分支信息
+	bm.UpdateBranch("test1", func(b *core.Branch) {
+		b.Merge(core.BranchMeta{Owner: "b@host", Ref: "v1"})
+		b.LastResult = core.NewCmdResult("update", fmt.Errorf("fail"))
+	})
+	b, _ = core.NewBranchManager(bm.Store).GetBranch("test1")
+	if b.Owner != "a@host" || b.Commit != "c1" || b.Ref != "v1" || b.Desc != "demo" || b.Labels[0] != "api" {
+		t.Fatalf("merge branch meta err:%+v", b.BranchMeta)
+	}
+	if r := b.LastResult; r == nil || r.Success || r.Message != "fail" || r.Cmd != "update" {
+		t.Fatalf("last result err:%+v", r)
+	}
+}
+
+func TestReap(t *testing.T) {
+	bm, dir := newBranchManager(t)
+	defer os.RemoveAll(dir)
+	old := time.Now().Add(-time.Hour).Format(core.TimeLayout)
+	bm.Tx(func(tx *core.BranchTx) error {
+		for _, name := range []string{"expired", "locked", "forever", "fresh"} {
+			tx.AddBranch(name, filepath.Join(dir, name))
+			os.MkdirAll(filepath.Join(dir, name), 0755)
+			b, _ := tx.GetBranch(name)
+			b.TTL = 60
+			b.LastUsed = old
+		}
+		forever, _ := tx.GetBranch("forever")
+		forever.TTL = 0
+		fresh, _ := tx.GetBranch("fresh")
+		fresh.LastUsed = time.Now().Format(core.TimeLayout)
+		return nil
+	})
+	bm.TryLock("locked", "a", time.Minute)
+	server := &task.TCPServerTask{
+		ReapCmd: "delete",
+		TaskDict: core.Map{"delete": {
+			core.Task{Type: "RemoveFileTask", Task: &task.RemoveFileTask{}},
+			core.Task{Type: "DeleteTask", Task: &task.DeleteTask{}},
+		}},
+	}
+	session := core.NewSession(context.Background(), "root", ioutil.Discard, bm)
+	session.WorkSpace = dir
+	if reaped := server.Reap(session); len(reaped) != 1 || reaped[0] != "expired" {
+		t.Fatalf("reaped err:%v", reaped)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "expired")); !os.IsNotExist(err) {
+		t.Fatal("expired branch files not removed")
+	}
+	if len(bm.Filter(func(*core.Branch, int) bool { return true })) != 3 || bm.IsLocked("expired") {
+		t.Fatal("reap branch info err")
+	}
+	bm.Unlock("locked", "a", false)
+	if reaped := server.Reap(session); len(reaped) != 1 || reaped[0] != "locked" {
+		t.Fatalf("reap unlocked branch err:%v", reaped)
+	}
+}
@@ -0,0 +1,89 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kite/src/task" //注册条件任务
+	"kite/src/task/core"
+)
+
+func TestBuiltinConditions(t *testing.T) {
+	bm, dir := newBranchManager(t)
+	defer os.RemoveAll(dir)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok"}`)
+	}))
+	defer server.Close()
+	ioutil.WriteFile(filepath.Join(dir, "httpd.conf"), []byte("ServerName test1.qgame.qq.com\n"), 0644)
+	session := core.NewSession(context.Background(), "root", ioutil.Discard, bm)
+	session.WorkSpace = dir
+	session.Branch = "test1"
+	session.Vars = map[string]string{"env": "prod", "replicas": "10"}
+	bm.AddBranch("test1", filepath.Join(dir, "test1"))
+	for cond, want := range map[string]int{
+		`{"__type__": "FileExistsCondition", "Path": "${workspace}/httpd.conf"}`:                                         1,
+		`{"__type__": "FileExistsCondition", "Path": "${workspace}/httpd.conf", "Type": "dir"}`:                          0,
+		`{"__type__": "FileExistsCondition", "Path": "${workspace}/none"}`:                                               0,
+		`{"__type__": "FileMatchCondition", "FilePath": "${workspace}/httpd.conf", "Regexp": "ServerName ${branch}\\."}`: 1,
+		`{"__type__": "FileMatchCondition", "FilePath": "${workspace}/none", "Regexp": "x"}`:                             0,
+		`{"__type__": "ShellCondition", "Cmd": "/bin/sh", "Args": ["test ${branch} = test1"]}`:                           1,
+		`{"__type__": "ShellCondition", "Cmd": "/bin/sh", "Args": ["exit 2"], "ExitCode": 2}`:                            1,
+		`{"__type__": "ShellCondition", "Cmd": "/bin/sh", "Args": ["exit 1"]}`:                                           0,
+		fmt.Sprintf(`{"__type__": "HTTPCondition", "Url": "%s/health", "Regexp": "\"ok\""}`, server.URL):                 1,
+		fmt.Sprintf(`{"__type__": "HTTPCondition", "Url": "%s/missing"}`, server.URL):                                    0,
+		fmt.Sprintf(`{"__type__": "HTTPCondition", "Url": "%s/missing", "Status": 404}`, server.URL):                     1,
+		`{"__type__": "HTTPCondition", "Url": "http://127.0.0.1:1/", "Timeout": 1}`:                                      0,
+		`{"__type__": "BranchExistsCondition"}`:                                                                          1,
+		`{"__type__": "BranchExistsCondition", "Branch": "${branch}-copy"}`:                                              0,
+		`{"__type__": "VarCondition", "Name": "env", "Value": "prod"}`:                                                   1,
+		`{"__type__": "VarCondition", "Name": "branch", "Op": "=~", "Value": "^test"}`:                                   1,
+		`{"__type__": "VarCondition", "Name": "replicas", "Op": ">", "Value": "9"}`:                                      1,
+		`{"__type__": "VarCondition", "Name": "missing", "Op": "!=", "Value": ""}`:                                       0,
+		`{"__type__": "ChangedCondition", "Patterns": ["composer.*"]}`:                                                   0,
+	} {
+		list := core.NewList()
+		if err := list.UnmarshalJSON([]byte(fmt.Sprintf(`[{"__type__": "IfElse", "Logic": "==", "Result": 1, "Cond": %s,
+			"Body": [{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo 1"], "Output": "result"}],
+			"ElseTask": [{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo 0"], "Output": "result"}]}]`, cond))); err != nil {
+			t.Fatalf("cond:%s err:%v", cond, err)
+		}
+		if err := list.Run(session); err != nil {
+			t.Fatalf("cond:%s err:%v", cond, err)
+		}
+		if session.Vars["result"] != fmt.Sprint(want) {
+			t.Fatalf("cond:%s got:%s want:%d", cond, session.Vars["result"], want)
+		}
+	}
+	if session.Vars["exitCode"] != "0" || session.Vars["statusCode"] == "" {
+		t.Fatalf("condition vars err:%v", session.Vars)
+	}
+	for left, right := range map[string]string{"10": "9", "b": "a", "1.5": "1.25"} {
+		if ok, _ := core.Compare(left, ">", right); !ok {
+			t.Fatalf("compare %s > %s fail", left, right)
+		}
+	}
+	if _, err := core.Compare("a", "<>", "b"); err == nil {
+		t.Fatal("compare with invalid op")
+	}
+	var out strings.Builder //请求失败时输出到session
+	session.Log = &out
+	cond := &task.HTTPCondition{URL: "http://127.0.0.1:1/", Status: http.StatusOK, Timeout: 1}
+	if ok, err := cond.Eval(session); ok || err != nil {
+		t.Fatalf("unreachable url ok:%v err:%v", ok, err)
+	}
+	if !strings.Contains(out.String(), "HTTPCondition request fail") {
+		t.Fatalf("request failure not logged:%q", out.String())
+	}
+}
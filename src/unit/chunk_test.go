@@ -0,0 +1,93 @@
+package unit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kite/src/task/message"
+)
+
+//saveChunk 模拟网络传输一个文件块并在服务端保存
+func saveChunk(t *testing.T, chunk *message.ChunkMessage, workspace string) error {
+	var buf bytes.Buffer
+	if _, err := chunk.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chunk.SendFile(&buf); err != nil {
+		t.Fatal(err)
+	}
+	chunk.Close()
+	req := message.NewRequest()
+	if _, err := req.ParseForm(&buf); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := req.ParseFormChunk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer msg.Close()
+	return msg.Save(workspace)
+}
+
+func TestChunkResume(t *testing.T) {
+	local, err := ioutil.TempDir("", "kite-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+	workspace, err := ioutil.TempDir("", "kite-ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workspace)
+	data := make([]byte, 1000)
+	rand.Read(data)
+	fpath := filepath.Join(local, "big.bin")
+	if err = ioutil.WriteFile(fpath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	query, err := message.NewChunkQuery(fpath, local, "/", "test1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	branchDir := filepath.Join(workspace, "test1") //客户端的路径不包含分支
+	if offset := query.ConfirmedOffset(branchDir); offset != 0 {
+		t.Fatalf("offset require:0; actual:%d", offset)
+	}
+	for _, compress := range []bool{false, true} { //上传前两块之后中断
+		chunk, err := query.Chunk(query.ConfirmedOffset(branchDir), 300, compress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = saveChunk(t, chunk, workspace); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if offset := query.ConfirmedOffset(branchDir); offset != 600 {
+		t.Fatalf("offset require:600; actual:%d", offset)
+	}
+	chunk, _ := query.Chunk(900, 300, false) //偏移量不一致
+	if err = saveChunk(t, chunk, workspace); err == nil {
+		t.Fatal("chunk with wrong offset saved")
+	}
+	for offset := query.ConfirmedOffset(branchDir); offset < query.Size; offset += 300 {
+		chunk, err := query.Chunk(offset, 300, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = saveChunk(t, chunk, workspace); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved, err := ioutil.ReadFile(filepath.Join(workspace, "test1", "big.bin"))
+	if err != nil || !bytes.Equal(saved, data) {
+		t.Fatalf("saved file err:%v", err)
+	}
+	if _, err = os.Stat(filepath.Join(workspace, "test1", "big.bin.kite-part.json")); !os.IsNotExist(err) {
+		t.Fatal("part state not removed")
+	}
+}
@@ -0,0 +1,89 @@
+package unit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"kite/src/task"
+	"kite/src/task/core"
+	"kite/src/task/message"
+)
+
+func TestErrorCode(t *testing.T) {
+	msg := message.NewMessage(false, message.SystemMessage, "method：lock; execute fail:locked")
+	msg.Code = message.CodeLocked
+	var buf bytes.Buffer
+	msg.WriteTo(&buf)
+	parsed, err := message.ParseMsg(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Code != message.CodeLocked || parsed.Content != msg.Content {
+		t.Fatalf("code not parsed:%+v", parsed)
+	}
+	//旧的服务端没有分类
+	parsed, _ = message.ParseMsg(bytes.NewBufferString("/msg?id=1&suc=0&type=0&content=fail\n"))
+	if code := core.ErrorCode(core.MessageError(parsed)); code != message.CodeFail {
+		t.Fatalf("message without code err:%d", code)
+	}
+	bm := &core.BranchManager{}
+	bm.TryLock("test1", "a", time.Minute)
+	if code := core.ErrorCode(bm.TryLock("test1", "b", time.Minute)); code != message.CodeLocked {
+		t.Fatalf("lock busy code err:%d", code)
+	}
+	if code := core.ErrorCode(fmt.Errorf("update:%w", core.WithCode(message.CodeNotExist, fmt.Errorf("branch:test1 not exist")))); code != message.CodeNotExist {
+		t.Fatalf("wrapped code err:%d", code)
+	}
+	if _, err = net.DialTimeout("tcp", "127.0.0.1:1", time.Second); core.ErrorCode(err) != message.CodeConn {
+		t.Fatalf("connection code err:%v", err)
+	}
+	if core.ErrorCode(nil) != message.CodeOK || core.ErrorCode(fmt.Errorf("fail")) != message.CodeFail {
+		t.Fatal("default code err")
+	}
+}
+
+//测试服务端没有返回执行结果就断开连接
+func TestClientUnexpectedEOF(t *testing.T) {
+	for _, c := range []struct {
+		reply string
+		code  message.Code
+	}{
+		{"/msg?id=1&suc=1&type=1&content=half\n", message.CodeConn},
+		{"", message.CodeConn},
+		{"/msg?id=1&suc=1&type=1&content=done\n/msg?id=2&suc=1&type=0&end=1&content=ok\n", message.CodeOK},
+	} {
+		listen, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func(reply string) {
+			conn, err := listen.Accept()
+			if err != nil {
+				return
+			}
+			bufio.NewReader(conn).ReadString('\n')
+			io.WriteString(conn, reply)
+			conn.Close()
+		}(c.reply)
+		client := &task.TCPClientTask{}
+		port := strings.TrimPrefix(listen.Addr().String(), "127.0.0.1:")
+		if err = client.Init(jsonMap(t, `{"Ip": "127.0.0.1", "Port": "`+port+`", "Content": "update", "Timeout": 1000}`)); err != nil {
+			t.Fatal(err)
+		}
+		session := core.NewSession(context.Background(), "client", ioutil.Discard, nil)
+		session.Branch = "test1"
+		err = client.Run(session)
+		listen.Close()
+		if code := core.ErrorCode(err); code != c.code {
+			t.Fatalf("reply:%q code:%d err:%v", c.reply, code, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	_ "kite/src/task" //注册ContainsTask
+	"kite/src/task/core"
+)
+
+func TestCompositeCondition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-cond")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "httpd.conf")
+	ioutil.WriteFile(conf, []byte("ServerName master.qgame.qq.com\n"), 0644)
+	contains := func(sub string) string {
+		return fmt.Sprintf(`{"__type__": "ContainsTask", "FilePath": %q, "SubString": %q}`, conf, sub)
+	}
+	//vhost不存在 并且 分支不是受保护的分支
+	cond := fmt.Sprintf(`{"__type__": "AndCondition", "Conds": [
+		{"__type__": "NotCondition", "Cond": %s},
+		{"__type__": "NotCondition", "Cond": {"__type__": "OrCondition", "Conds": [%s, %s]}}
+	]}`, contains("ServerName ${branch}."), contains("${branch}.protected"), contains("release-${branch}"))
+	list := core.NewList()
+	err = json.Unmarshal([]byte(fmt.Sprintf(`[{"__type__": "IfElse", "Logic": "==", "Result": 1, "Cond": %s,
+		"Body": [{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo yes"], "Output": "matched"}],
+		"ElseTask": [{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo no"], "Output": "matched"}]}]`, cond)), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for branch, want := range map[string]string{"feature": "yes", "master": "no"} {
+		session := core.NewSession(context.Background(), "root", ioutil.Discard, nil)
+		session.Branch = branch
+		if err = list.Run(session); err != nil {
+			t.Fatal(err)
+		}
+		if val, _ := session.Var("matched"); val != want {
+			t.Fatalf("branch:%s got:%s want:%s", branch, val, want)
+		}
+	}
+	ioutil.WriteFile(conf, []byte("feature.protected\n"), 0644)
+	session := core.NewSession(context.Background(), "root", ioutil.Discard, nil)
+	session.Branch = "feature"
+	if list.Run(session); session.Vars["matched"] != "no" {
+		t.Fatal("protected branch matched")
+	}
+	data, err := json.Marshal(&list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := core.NewList()
+	if err = json.Unmarshal(data, &copied); err != nil {
+		t.Fatalf("unmarshal saved conditions err:%v", err)
+	}
+	invalid := core.NewList()
+	if err = json.Unmarshal([]byte(`[{"__type__": "AndCondition", "Conds": [{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": []}]}]`), &invalid); err == nil {
+		t.Fatal("accept task that is not a condition")
+	}
+}
+
+//测试多个会话同时执行同一个条件：结果不能互相影响
+func TestConditionConcurrent(t *testing.T) {
+	list := core.NewList()
+	err := json.Unmarshal([]byte(`[{"__type__": "IfElse", "Logic": "==", "Result": 1,
+		"Cond": {"__type__": "AndCondition", "Conds": [
+			{"__type__": "NotCondition", "Cond": {"__type__": "VarCondition", "Name": "branch", "Op": "=~", "Value": "^release"}},
+			{"__type__": "OrCondition", "Conds": [{"__type__": "VarCondition", "Name": "branch", "Op": "=~", "Value": "[02468]$"}]}
+		]},
+		"Body": [{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo even"], "Output": "matched"}],
+		"ElseTask": [{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo other"], "Output": "matched"}]}]`), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			session := core.NewSession(context.Background(), "root", ioutil.Discard, nil)
+			session.Branch = fmt.Sprintf("feature%d", i)
+			want := "other"
+			if i%2 == 0 {
+				want = "even"
+			}
+			if err := list.Run(session); err != nil {
+				errs <- err
+			} else if val, _ := session.Var("matched"); val != want {
+				errs <- fmt.Errorf("branch:%s got:%s want:%s", session.Branch, val, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,53 @@
+package unit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"kite/src/util"
+)
+
+//patch 根据旧数据的签名生成差异并还原新数据，返回差异大小
+func patch(t *testing.T, base, data []byte, blockSize int) int {
+	sigs, err := util.Signatures(bytes.NewReader(base), blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := util.DecodeSignatures(util.EncodeSignatures(sigs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var delta, out bytes.Buffer
+	if err = util.Delta(bytes.NewReader(data), decoded, blockSize, &delta); err != nil {
+		t.Fatal(err)
+	}
+	size := delta.Len()
+	if err = util.Patch(bytes.NewReader(base), blockSize, &delta, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("patched data not equal")
+	}
+	return size
+}
+
+func TestDelta(t *testing.T) {
+	base := make([]byte, 100000)
+	rand.Read(base)
+	block := 1000
+	modified := append([]byte{}, base...)
+	copy(modified[50000:], "changed")
+	inserted := append(append(append([]byte{}, base[:30000]...), "inserted"...), base[30000:]...)
+	removed := append(append([]byte{}, base[:70000]...), base[70500:]...)
+	for name, data := range map[string][]byte{"same": base, "modified": modified, "inserted": inserted, "removed": removed} {
+		if size := patch(t, base, data, block); size > 3*block {
+			t.Fatalf("%s delta too large:%d", name, size)
+		}
+	}
+	other := make([]byte, 5000)
+	rand.Read(other)
+	patch(t, base, other, block)      //没有相同的块
+	patch(t, base[:500], base, block) //旧数据不足一块
+	patch(t, base, []byte{}, block)
+}
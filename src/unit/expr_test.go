@@ -0,0 +1,87 @@
+package unit
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	_ "kite/src/task" //注册ShellTask
+	"kite/src/task/core"
+)
+
+func TestExpr(t *testing.T) {
+	vars := map[string]string{"branch": "hotfix/login", "vars.env": "prod", "exitCode": "0", "count": "12"}
+	lookup := func(name string) string { return vars[name] }
+	for src, want := range map[string]bool{
+		`branch =~ "^hotfix"`:                             true,
+		`vars.env == "prod" && exitCode != 0`:             false,
+		`vars.env == 'prod' && !(exitCode != 0)`:          true,
+		`branch !~ "^hotfix" || count >= 10`:              true,
+		`count > 9 && count < 100`:                        true,
+		`missing`:                                         false,
+		`!missing && exitCode == 0`:                       true,
+		`exitCode`:                                        false,
+		`vars.env == "dev" || vars.env == "qa" || false`:  false,
+		`count == 12.0 || -1 > 0`:                         false,
+		`'it\'s' == "it's" && "say \"hi\"" == 'say "hi"'`: true,
+		`'a\\b' == "a\\b" && 'a\tb' == "a\tb"`:            true,
+		`'it\'s' == 'it\\'`:                               false,
+	} {
+		expr, err := core.ParseExpr(src)
+		if err != nil {
+			t.Fatalf("parse:%s err:%v", src, err)
+		}
+		if got, err := expr.Eval(lookup); err != nil || got != want {
+			t.Fatalf("eval:%s got:%v want:%v err:%v", src, got, want, err)
+		}
+	}
+	for _, src := range []string{`branch ==`, `(branch == "a"`, `branch == "a" "b"`, `"abc`, `branch # 1`, `&& a`, `'a\q'`} {
+		if _, err := core.ParseExpr(src); err == nil {
+			t.Fatalf("parse:%s should fail", src)
+		}
+	}
+	list := core.NewList()
+	err := list.UnmarshalJSON([]byte(`[
+		{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo prod"], "Output": "deployed", "When": "vars.env == \"prod\""},
+		{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo hotfix"], "Output": "skipped", "Unless": "branch =~ \"^hotfix\""},
+		{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["exit 1"], "Ignore": 1},
+		{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo fail"], "Output": "failed", "When": "exitCode != 0"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := core.NewSession(context.Background(), "root", ioutil.Discard, nil)
+	session.Branch = "hotfix/login"
+	session.Vars = map[string]string{"env": "prod"}
+	if err = list.Run(session); err != nil {
+		t.Fatal(err)
+	}
+	if session.Vars["deployed"] != "prod" || session.Vars["failed"] != "fail" {
+		t.Fatalf("when not executed:%v", session.Vars)
+	}
+	if _, ok := session.Vars["skipped"]; ok {
+		t.Fatal("unless not skipped")
+	}
+	if data, _ := list[0].MarshalJSON(); !strings.Contains(string(data), `"When":"vars.env == \"prod\""`) {
+		t.Fatalf("marshal when err:%s", data)
+	}
+	//没有执行过命令时exitCode为0
+	first := core.NewList()
+	if err = first.UnmarshalJSON([]byte(`[
+		{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo fail"], "Output": "failed", "When": "exitCode != 0"},
+		{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo ok"], "Output": "passed", "When": "exitCode == 0"}
+	]`)); err != nil {
+		t.Fatal(err)
+	}
+	session = core.NewSession(context.Background(), "root", ioutil.Discard, nil)
+	if err = first.Run(session); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := session.Vars["failed"]; ok || session.Vars["passed"] != "ok" {
+		t.Fatalf("missing exitCode not 0:%v", session.Vars)
+	}
+	if err = list.UnmarshalJSON([]byte(`[{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": [], "When": "a =="}]`)); err == nil {
+		t.Fatal("invalid when accepted")
+	}
+}
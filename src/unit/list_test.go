@@ -0,0 +1,63 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"kite/src/task"
+	"kite/src/task/core"
+)
+
+func TestListQuery(t *testing.T) {
+	bm, dir := newBranchManager(t)
+	defer os.RemoveAll(dir)
+	for _, item := range []struct {
+		name   string
+		labels string
+	}{{"feature-a", "qa,api"}, {"feature-b", "qa"}, {"release", "api"}} {
+		session := core.NewSession(context.Background(), "root", ioutil.Discard, bm)
+		session.WorkSpace = dir
+		session.Branch = item.name
+		session.Meta = core.BranchMeta{Owner: "root@host", Labels: core.ParseLabels(item.labels)}
+		if err := (&task.InitTask{}).Run(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(query string) (string, error) {
+		var buf bytes.Buffer
+		session := core.NewSession(context.Background(), "root", &buf, bm)
+		session.WorkSpace = dir
+		if _, err := session.Request().ParseForm(strings.NewReader("/list?" + query + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		err := (&task.ListTask{}).Run(session)
+		out, _ := url.QueryUnescape(buf.String())
+		return out, err
+	}
+	out, err := list("name=feature-*&label=qa&format=json&sort=-name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := strings.Index(out, `"name":"feature-a"`), strings.Index(out, `"name":"feature-b"`); a == -1 || b == -1 || b > a {
+		t.Fatalf("filter or sort err:%s", out)
+	}
+	if strings.Contains(out, `"name":"release"`) {
+		t.Fatalf("name filter err:%s", out)
+	}
+	if out, _ = list("label=api,qa&format=csv"); !strings.Contains(out, "feature-a") || strings.Contains(out, "feature-b") {
+		t.Fatalf("label filter err:%s", out)
+	}
+	if out, _ = list("ownedby=root&older=1h"); strings.Contains(out, "feature") {
+		t.Fatalf("older filter err:%s", out)
+	}
+	for _, query := range []string{"sort=color", "format=xml", "older=3days", "name=[a"} {
+		if _, err = list(query); err == nil {
+			t.Fatalf("invalid query accepted:%s", query)
+		}
+	}
+}
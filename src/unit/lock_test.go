@@ -0,0 +1,159 @@
+package unit
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"kite/src/task"
+	"kite/src/task/core"
+	"kite/src/task/message"
+)
+
+func TestBranchLock(t *testing.T) {
+	bm := &core.BranchManager{}
+	if err := bm.TryLock("test1", "a", time.Minute); err != nil {
+		t.Fatal("lock test1 fail")
+	}
+	if err := bm.TryLock("test2", "b", time.Minute); err != nil {
+		t.Fatal("lock different branches fail")
+	}
+	if err := bm.TryLock("test1", "b", time.Minute); err == nil {
+		t.Fatal("lock the branch held by others")
+	}
+	if err := bm.TryLock("test1", "a", time.Minute); err != nil {
+		t.Fatal("holder lock again fail")
+	}
+	if err := bm.TryLock(core.GlobalLock, "c", time.Minute); err == nil {
+		t.Fatal("global lock while branches locked")
+	}
+	bm.Unlock("test1", "a", false)
+	bm.Unlock("test2", "b", false)
+	if err := bm.TryLock(core.GlobalLock, "c", time.Minute); err != nil {
+		t.Fatal("global lock fail")
+	}
+	if err := bm.TryLock("test3", "a", time.Minute); err == nil || !bm.IsLocked("test3") {
+		t.Fatal("lock branch while global locked")
+	}
+	bm.Unlock(core.GlobalLock, "c", false)
+	if err := bm.TryLock("test3", "a", time.Minute); err != nil {
+		t.Fatal("lock branch after global unlocked fail")
+	}
+}
+
+func TestLockLease(t *testing.T) {
+	bm := &core.BranchManager{}
+	bm.TryLock("test1", "a", 50*time.Millisecond)
+	if err := bm.Unlock("test1", "b", false); err == nil {
+		t.Fatal("unlock the branch held by others")
+	}
+	if err := bm.Unlock("test1", "b", true); err != nil || bm.IsLocked("test1") {
+		t.Fatalf("force unlock fail:%v", err)
+	}
+	bm.TryLock("test1", "a", 50*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	bm.Renew("test1", "a", "update")
+	time.Sleep(30 * time.Millisecond)
+	if err := bm.TryLock("test1", "b", time.Minute); err == nil {
+		t.Fatal("lock the renewed lease")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := bm.TryLock("test1", "b", time.Minute); err != nil {
+		t.Fatal("lock the expired lease fail")
+	}
+}
+
+func TestLockStatus(t *testing.T) {
+	bm := &core.BranchManager{}
+	bm.TryLock("test2", "b", time.Minute)
+	bm.TryLock("test1", "a", time.Minute)
+	bm.TryLock("test3", "c", time.Millisecond)
+	bm.Renew("test1", "a", "update")
+	time.Sleep(5 * time.Millisecond)
+	leases := bm.Leases()
+	if len(leases) != 2 || leases[0].Branch != "test1" || leases[1].Branch != "test2" {
+		t.Fatalf("leases err:%v", leases)
+	}
+	if leases[0].Holder != "a" || leases[0].Cmd != "update" || leases[1].Cmd != "" {
+		t.Fatalf("lease info err:%v", leases)
+	}
+}
+
+func TestWaitLock(t *testing.T) {
+	bm := &core.BranchManager{}
+	bm.TryLock("test1", "a", time.Minute)
+	order := make(chan string, 2)
+	positions := make(chan int, 10)
+	for _, holder := range []string{"b", "c"} {
+		go func(holder string) {
+			err := bm.WaitLock(context.Background(), "test1", holder, time.Minute, func(ahead int) error {
+				if holder == "c" {
+					positions <- ahead
+				}
+				return nil
+			})
+			if err == nil {
+				order <- holder
+				bm.Unlock("test1", holder, false)
+			}
+		}(holder)
+		time.Sleep(20 * time.Millisecond) //保证排队的顺序
+	}
+	if <-positions != 1 {
+		t.Fatal("position of c err")
+	}
+	if err := bm.TryLock("test2", "d", time.Minute); err != nil {
+		t.Fatal("lock other branch while waiting fail")
+	}
+	if err := bm.TryLock("test1", "d", time.Minute); err == nil {
+		t.Fatal("lock ahead of the queue")
+	}
+	bm.Unlock("test1", "a", false)
+	if first, second := <-order, <-order; first != "b" || second != "c" {
+		t.Fatalf("lock order err:%s,%s", first, second)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := bm.WaitLock(ctx, "test2", "e", time.Minute, func(int) error { return nil }); err != context.DeadlineExceeded {
+		t.Fatalf("wait timeout err:%v", err)
+	}
+	if err := bm.TryLock("test1", "e", time.Minute); err != nil {
+		t.Fatalf("queue not cleared:%v", err)
+	}
+}
+
+//测试启用签名时锁与签名的key绑定：其他key复制持有者也不能释放锁，locks只显示user@host
+func TestLockHolderIdentity(t *testing.T) {
+	port, bm := startServerConfig(t, tempDir(t, "kite-ws"), map[string]interface{}{
+		"AuthKeys": map[string]interface{}{"k1": "s1", "k2": "s2"},
+		"TaskDict": jsonMap(t, `{"lock": [{"__type__": "LockTask"}], "unlock": [{"__type__": "UnlockTask"}], "locks": [{"__type__": "LockStatusTask"}]}`),
+	})
+	run := func(cmd, key, secret string) (string, error) {
+		client := &task.TCPClientTask{}
+		if err := client.Init(jsonMap(t, `{"Ip": "127.0.0.1", "Port": "`+port+`", "Content": "`+cmd+`", "Timeout": 3000, "KeyID": "`+key+`", "Secret": "`+secret+`"}`)); err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		session := core.NewSession(context.Background(), "client", ioutil.Discard, nil)
+		session.Branch = "test1"
+		session.Holder = "alice@dev/0a1b2c3d"
+		session.OnMessage = func(msg *message.Message) { out.WriteString(msg.Content + "\n") }
+		err := client.Run(session)
+		return out.String(), err
+	}
+	if _, err := run("lock", "k1", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := run("locks", "k2", "s2")
+	if err != nil || !strings.Contains(out, "alice@dev\t") || strings.Contains(out, "0a1b2c3d") {
+		t.Fatalf("locks output err:%s,%v", out, err)
+	}
+	if _, err = run("unlock", "k2", "s2"); err == nil || !bm.IsLocked("test1") {
+		t.Fatal("another key released the lock with a copied holder")
+	}
+	if _, err = run("unlock", "k1", "s1"); err != nil || bm.IsLocked("test1") {
+		t.Fatalf("holder unlock fail:%v", err)
+	}
+}
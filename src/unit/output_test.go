@@ -0,0 +1,52 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "kite/src/task" //注册ShellTask、CurlTask
+	"kite/src/task/core"
+)
+
+func TestOutputCapture(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"data":{"items":[{"id":"%s"}]}}`, r.URL.Query().Get("b"))
+	}))
+	defer server.Close()
+	list := core.NewList()
+	err := json.Unmarshal([]byte(fmt.Sprintf(`[
+		{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo '  0123456789abcdef '"], "Output": "commitId"},
+		{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo version=v1.2.3"], "Output": "version", "Regexp": "version=(\\S+)"},
+		{"__type__": "CurlTask", "Url": "%s/?b=${commitId|sha-short}", "Param": "", "Method": 0, "Output": "itemId", "JSONPath": "data.items.0.id"},
+		{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["exit 3"], "Output": "fail", "Ignore": 1}
+	]`, server.URL)), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := core.NewSession(context.Background(), "root", ioutil.Discard, nil)
+	if err = list.Run(session); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"commitId":   "0123456789abcdef",
+		"version":    "v1.2.3",
+		"itemId":     "0123456",
+		"statusCode": "200",
+		"fail.code":  "3",
+		"exitCode":   "3",
+	} {
+		if val, _ := session.Var(name); val != want {
+			t.Fatalf("var:%s got:%s want:%s", name, val, want)
+		}
+	}
+	bad := core.NewList()
+	json.Unmarshal([]byte(`[{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo abc"], "Output": "x", "Regexp": "\\d+"}]`), &bad)
+	if err = bad.Run(session); err == nil {
+		t.Fatal("capture without match should fail")
+	}
+}
@@ -0,0 +1,70 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"kite/src/task"
+	"kite/src/task/core"
+	"kite/src/task/message"
+)
+
+func TestParamTask(t *testing.T) {
+	list := core.NewList()
+	err := json.Unmarshal([]byte(`[
+		{"__type__": "ParamTask", "Name": "env", "Required": true, "Values": ["dev", "qa"]},
+		{"__type__": "ParamTask", "Name": "port", "Default": "8080"}
+	]`), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(vars map[string]string) (*core.Session, error) {
+		session := core.NewSession(context.Background(), "root", ioutil.Discard, nil)
+		session.Vars = vars
+		return session, list.Run(session)
+	}
+	session, err := run(map[string]string{"env": "qa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url, _ := session.Expand("http://${env}.host:${port}"); url != "http://qa.host:8080" {
+		t.Fatalf("default not applied:%s", url)
+	}
+	if session, _ = run(map[string]string{"env": "dev", "port": "9000"}); session.Vars["port"] != "9000" {
+		t.Fatal("default overwrite the var")
+	}
+	for _, vars := range []map[string]string{nil, {"env": "prod"}} {
+		if _, err = run(vars); core.ErrorCode(err) != message.CodeConfig {
+			t.Fatalf("invalid vars %v err:%v", vars, err)
+		}
+	}
+}
+
+//测试服务端只保留命令声明的参数
+func TestDeclaredVars(t *testing.T) {
+	port, _ := startServer(t, tempDir(t, "kite-ws"), `{
+		"declared": [{"__type__": "ParamTask", "Name": "env"}, {"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo ${env:-none} ${x:-none}"]}],
+		"undeclared": [{"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo ${env:-none} ${x:-none}"]}],
+		"nested": [{"__type__": "IfElse", "Logic": "==", "Result": 1, "Cond": {"__type__": "VarCondition", "Name": "branch", "Value": ""},
+			"Body": [{"__type__": "ParamTask", "Name": "env"}, {"__type__": "ShellTask", "Cmd": "/bin/sh", "Args": ["echo ${env:-none} ${x:-none}"]}]}]
+	}`)
+	for cmd, want := range map[string]string{"declared": "qa none", "undeclared": "none none", "nested": "qa none"} {
+		client := &task.TCPClientTask{}
+		if err := client.Init(jsonMap(t, `{"Ip": "127.0.0.1", "Port": "`+port+`", "Content": "`+cmd+`", "Timeout": 3000}`)); err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		session := core.NewSession(context.Background(), "client", ioutil.Discard, nil)
+		session.Vars = map[string]string{"env": "qa", "x": "$(id)"}
+		session.OnMessage = func(msg *message.Message) { out.WriteString(msg.Content) }
+		if err := client.Run(session); err != nil {
+			t.Fatalf("cmd:%s err:%v", cmd, err)
+		}
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Fatalf("cmd:%s output:%s want:%s", cmd, out.String(), want)
+		}
+	}
+}
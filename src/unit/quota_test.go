@@ -0,0 +1,46 @@
+package unit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kite/src/task"
+	"kite/src/task/core"
+	"kite/src/util"
+)
+
+func TestQuota(t *testing.T) {
+	bm, dir := newBranchManager(t)
+	defer os.RemoveAll(dir)
+	initTask := &task.InitTask{MaxBranches: 1}
+	session := core.NewSession(context.Background(), "root", ioutil.Discard, bm)
+	session.WorkSpace = dir
+	session.Branch = "test1"
+	if err := initTask.Run(session); err != nil {
+		t.Fatal(err)
+	}
+	session.Branch = "test2"
+	if err := initTask.Run(session); err == nil {
+		t.Fatal("create branches over the limit")
+	}
+	os.MkdirAll(filepath.Join(dir, "test1", "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "test1", "a.txt"), make([]byte, 1000), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "test1", "sub", "b.txt"), make([]byte, 24), 0644)
+	if size, err := util.DirSize(filepath.Join(dir, "test1")); err != nil || size != 1024 {
+		t.Fatalf("dir size err:%d,%v", size, err)
+	}
+	if size, err := util.DirSize(filepath.Join(dir, "none")); err != nil || size != 0 {
+		t.Fatalf("size of not exist dir err:%d,%v", size, err)
+	}
+	if free, err := util.DiskFree(dir); err != nil || free <= 0 {
+		t.Fatalf("disk free err:%d,%v", free, err)
+	}
+	for size, text := range map[int64]string{100: "100B", 1536: "1.5KB", 3 << 30: "3.0GB"} {
+		if util.FormatSize(size) != text {
+			t.Fatalf("format size err:%s", util.FormatSize(size))
+		}
+	}
+}
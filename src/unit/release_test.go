@@ -0,0 +1,61 @@
+package unit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kite/src/task/message"
+	"kite/src/util"
+)
+
+func TestRelease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, dst := filepath.Join(dir, "1"), filepath.Join(dir, "2")
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("v1"), 0644)
+	os.Symlink("sub/a.txt", filepath.Join(src, "link"))
+	if err = util.LinkTree(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := os.Stat(filepath.Join(src, "sub", "a.txt"))
+	seeded, _ := os.Stat(filepath.Join(dst, "sub", "a.txt"))
+	if !os.SameFile(old, seeded) {
+		t.Fatal("release not seeded by hardlink")
+	}
+	if link, _ := os.Readlink(filepath.Join(dst, "link")); link != "sub/a.txt" {
+		t.Fatalf("symlink not copied:%s", link)
+	}
+	//上传到新的发布不能修改上一个发布的硬链接文件
+	local := filepath.Join(dir, "local")
+	os.MkdirAll(filepath.Join(local, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(local, "sub", "a.txt"), []byte("v2"), 0644)
+	msg, err := message.NewFileMessage(filepath.Join(local, "sub", "a.txt"), local, "2", "test1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer msg.Close()
+	if err = msg.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dst, "sub", "a.txt")); string(data) != "v2" {
+		t.Fatalf("upload to release fail:%s", data)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(src, "sub", "a.txt")); string(data) != "v1" {
+		t.Fatalf("previous release modified:%s", data)
+	}
+	current := filepath.Join(dir, "current")
+	for _, target := range []string{"1", "2"} {
+		if err = util.SwitchLink(target, current); err != nil {
+			t.Fatal(err)
+		}
+		if link, _ := os.Readlink(current); link != target {
+			t.Fatalf("switch current fail:%s", link)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -14,9 +15,9 @@ import (
 	"kite/src/util"
 )
 
-//测试任务的序列化
-func TestSaveTask(t *testing.T) {
-	taskQueue := core.List{
+//testTaskQueue 序列化测试使用的任务列表
+func testTaskQueue() core.List {
+	return core.List{
 		core.Task{
 			Type: "CurlTask",
 			Task: &task.CurlTask{
@@ -67,32 +68,26 @@ func TestSaveTask(t *testing.T) {
 			},
 		},
 	}
-	path := util.GetCurrentPath() + "/task.json"
-	if !util.FileExists(path) {
-		_, err := os.Create(path)
-		if err != nil {
-			t.Logf("配置文件创建失败：%v", err)
-			return
-		}
-	}
-	err := core.Save("E:\\git\\learn\\GO\\kite\\task.json", &taskQueue)
-	if err != nil {
-		t.Log(err)
+}
+
+//测试任务的序列化
+func TestSaveTask(t *testing.T) {
+	taskQueue := testTaskQueue()
+	path := filepath.Join(t.TempDir(), "task.json") //写到临时目录，不在源码目录留下文件
+	if err := core.Save(path, &taskQueue); err != nil {
+		t.Fatal(err)
 	}
 }
 
 //测试任务的反序列化
 func TestLoadTask(t *testing.T) {
-	// path := util.GetCurrentPath() + "/task.json"
-	// if !util.FileExists(path) {
-	// 	_, err := os.Create(path)
-	// 	if err != nil {
-	// 		t.Logf("配置文件创建失败：%v", err)
-	// 		return
-	// 	}
-	// }
+	saved := testTaskQueue()
+	path := filepath.Join(t.TempDir(), "task.json")
+	if err := core.Save(path, &saved); err != nil {
+		t.Fatal(err)
+	}
 	taskQueue := core.NewList()
-	err := core.Load("E:\\git\\learn\\GO\\kite\\task.json", &taskQueue)
+	err := core.Load(path, &taskQueue)
 	if err != nil {
 		t.Log(err)
 	}
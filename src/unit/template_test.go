@@ -0,0 +1,58 @@
+package unit
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"testing"
+
+	"kite/src/task/core"
+)
+
+func TestExpand(t *testing.T) {
+	session := core.NewSession(context.Background(), "root", ioutil.Discard, nil)
+	session.WorkSpace = "/data/ws"
+	session.Branch = "feature/Login"
+	session.Meta.Commit = "0123456789abcdef"
+	session.Vars = map[string]string{"empty": "", "host": "qgame.qq.com"}
+	for tpl, want := range map[string]string{
+		"${branchPath}/public":            "/data/ws/feature/Login/public",
+		"${branch|slug}.${host}":          "feature-login.qgame.qq.com",
+		"${branch|lower|slug}":            "feature-login",
+		"${commit|sha-short}":             "0123456",
+		"${port:-8080}":                   "8080",
+		"${empty:-${host}}":               "qgame.qq.com",
+		"${ref:-${branch}|slug}":          "feature-login",
+		"$${branch}":                      "${branch}",
+		"echo ${HOME} ${var#pre} $1":      "echo ${HOME} ${var#pre} $1",
+		"(?msU)###${branch}_begin###${1}": "(?msU)###feature/Login_begin###${1}",
+	} {
+		got, err := session.Expand(tpl)
+		if err != nil {
+			t.Fatalf("expand:%s err:%v", tpl, err)
+		}
+		if got != want {
+			t.Fatalf("expand:%s got:%s want:%s", tpl, got, want)
+		}
+	}
+	//外部传入的值作为shell参数与正则表达式时需要转义
+	session.Vars["x"] = `$(touch /tmp/kite-pwn); it's`
+	session.Branch = "a.b+c"
+	if got, _ := session.Expand("${x|shell}"); got != `'$(touch /tmp/kite-pwn); it'\''s'` {
+		t.Fatalf("shell filter err:%s", got)
+	}
+	arg, _ := session.Expand("printf %s ${x|shell}")
+	if out, err := exec.Command("/bin/sh", "-c", arg).Output(); err != nil || string(out) != session.Vars["x"] {
+		t.Fatalf("shell quoted arg err:%s,%v", out, err)
+	}
+	pattern, _ := session.Expand("^${branch|regex}$")
+	if reg := regexp.MustCompile(pattern); !reg.MatchString("a.b+c") || reg.MatchString("aXbbc") {
+		t.Fatalf("regex filter err:%s", pattern)
+	}
+	for _, tpl := range []string{"${branch|md5}", "${missing|lower}", "${branch"} {
+		if _, err := session.Expand(tpl); err == nil {
+			t.Fatalf("expand:%s should fail", tpl)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package unit
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kite/src/util"
+)
+
+//genCert 生成自签名证书，返回证书与私钥的路径
+func genCert(t *testing.T, dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{name},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err = ioutil.WriteFile(certPath, certPem, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyPath, keyPem, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+//echoServer 启动一个回显一行数据的tls服务
+func echoServer(t *testing.T, certFile, keyFile, clientCA string) net.Listener {
+	cfg, err := util.NewServerTLSConfig(certFile, keyFile, clientCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen, err := util.Listen("127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					return
+				}
+				conn.Write([]byte(line))
+			}(conn)
+		}
+	}()
+	return listen
+}
+
+//echo 发送一行数据，并读取回显
+func echo(addr, caFile, certFile, keyFile string) (string, error) {
+	cfg, err := util.NewClientTLSConfig(caFile, "127.0.0.1", certFile, keyFile)
+	if err != nil {
+		return "", err
+	}
+	conn, err := util.DialTimeout(addr, time.Second, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("/list?branch=test\n")); err != nil {
+		return "", err
+	}
+	return bufio.NewReader(conn).ReadString('\n')
+}
+
+//测试tls连接
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey := genCert(t, dir, "server")
+	listen := echoServer(t, serverCert, serverKey, "")
+	defer listen.Close()
+
+	line, err := echo(listen.Addr().String(), serverCert, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "/list?branch=test\n" {
+		t.Fatalf("echo err:%q", line)
+	}
+	//不信任服务端证书
+	otherCert, _ := genCert(t, dir, "other")
+	if _, err = echo(listen.Addr().String(), otherCert, "", ""); err == nil {
+		t.Fatal("untrusted server cert must fail")
+	}
+}
+
+//测试双向认证
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey := genCert(t, dir, "server")
+	clientCert, clientKey := genCert(t, dir, "client")
+	listen := echoServer(t, serverCert, serverKey, clientCert)
+	defer listen.Close()
+
+	if _, err := echo(listen.Addr().String(), serverCert, clientCert, clientKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := echo(listen.Addr().String(), serverCert, "", ""); err == nil {
+		t.Fatal("client without cert must fail")
+	}
+}
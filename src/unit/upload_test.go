@@ -0,0 +1,368 @@
+package unit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kite/src/task"
+	"kite/src/task/core"
+	"kite/src/task/message"
+	"kite/src/util"
+)
+
+//startUploadServer 在随机端口启动接收文件的服务，返回端口号与分支管理者
+func startUploadServer(t *testing.T, workspace string, receive string) (string, *core.BranchManager) {
+	return startServer(t, workspace, `{"upload": [`+receive+`]}`)
+}
+
+//startServer 在随机端口启动服务，taskDict为TaskDict的json，返回端口号与分支管理者
+func startServer(t *testing.T, workspace string, taskDict string) (string, *core.BranchManager) {
+	return startServerConfig(t, workspace, map[string]interface{}{"TaskDict": jsonMap(t, taskDict)})
+}
+
+//startServerConfig 在随机端口启动服务，config为TCPServerTask的配置(不需要Port)，返回端口号与分支管理者
+func startServerConfig(t *testing.T, workspace string, config map[string]interface{}) (string, *core.BranchManager) {
+	bm, dir := newBranchManager(t)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strings.TrimPrefix(listen.Addr().String(), "127.0.0.1:")
+	listen.Close()
+	config["Port"] = port
+	config["ReapInterval"] = float64(0)
+	server := &task.TCPServerTask{}
+	if err = server.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	session := core.NewSession(ctx, "root", ioutil.Discard, bm)
+	session.WorkSpace = workspace
+	go server.Run(session)
+	for i := 0; i < 50; i++ { //等待服务启动
+		if conn, err := net.Dial("tcp", "127.0.0.1:"+port); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return port, bm
+}
+
+//sendFiles 使用SendFileTask上传本地目录到分支test1，返回客户端的输出
+func sendFiles(t *testing.T, local, port string, opts string) (string, error) {
+	send := &task.SendFileTask{}
+	data := jsonMap(t, `{"Path": "`+local+`", "DstPath": "/", "IP": "127.0.0.1", "Port": "`+port+`"`+opts+`}`)
+	if err := send.Init(data); err != nil {
+		t.Fatal(err)
+	}
+	out := &lockedBuffer{}
+	session := core.NewSession(context.Background(), "client", out, nil)
+	session.Log = out
+	session.Branch = "test1"
+	err := send.Run(session)
+	return out.String(), err
+}
+
+//lockedBuffer 多个上传连接同时写入输出时加锁
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+//Write 写入输出
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+//String 已经写入的输出
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+//writeFiles 在目录下写入文件：相对路径 => 内容
+func writeFiles(t *testing.T, dir string, files map[string]string, perm os.FileMode) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), perm); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(path, perm)
+	}
+}
+
+//tempDir 创建测试结束时删除的临时目录
+func tempDir(t *testing.T, prefix string) string {
+	dir, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+//测试清单对比：内容一致的文件不上传，只有权限不一致时修改权限
+func TestManifestUpload(t *testing.T) {
+	local, workspace := tempDir(t, "kite-local"), tempDir(t, "kite-ws")
+	writeFiles(t, local, map[string]string{"same.txt": "same", "mode.txt": "mode", "changed.txt": "new", "sub/new.txt": "new"}, 0644)
+	writeFiles(t, filepath.Join(workspace, "test1"), map[string]string{"same.txt": "same", "changed.txt": "old"}, 0644)
+	writeFiles(t, filepath.Join(workspace, "test1"), map[string]string{"mode.txt": "mode"}, 0600)
+	port, _ := startUploadServer(t, workspace, `{"__type__": "ReceiveFileTask", "IPLists": "127.0.0.1"}`)
+	before := map[string]os.FileInfo{}
+	for _, name := range []string{"same.txt", "mode.txt"} {
+		before[name], _ = os.Stat(filepath.Join(workspace, "test1", name))
+	}
+	out, err := sendFiles(t, local, port, `, "ManifestMin": 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "manifest: 4 files, 2 need upload") {
+		t.Fatalf("manifest output err:%s", out)
+	}
+	for name, content := range map[string]string{"same.txt": "same", "mode.txt": "mode", "changed.txt": "new", "sub/new.txt": "new"} {
+		if data, _ := ioutil.ReadFile(filepath.Join(workspace, "test1", name)); string(data) != content {
+			t.Fatalf("file:%s content err:%s", name, data)
+		}
+	}
+	for name, info := range before {
+		after, _ := os.Stat(filepath.Join(workspace, "test1", name))
+		if !os.SameFile(info, after) {
+			t.Fatalf("file:%s uploaded again", name)
+		}
+		if after.Mode().Perm() != 0644 {
+			t.Fatalf("file:%s mode err:%o", name, after.Mode().Perm())
+		}
+	}
+}
+
+//测试发布目录中只有权限不一致时不修改上一个版本的硬链接文件
+func TestManifestReleaseMode(t *testing.T) {
+	local, workspace := tempDir(t, "kite-local"), tempDir(t, "kite-ws")
+	writeFiles(t, local, map[string]string{"mode.txt": "mode"}, 0755)
+	branch := filepath.Join(workspace, "test1")
+	writeFiles(t, filepath.Join(branch, "releases", "0"), map[string]string{"mode.txt": "mode"}, 0644)
+	os.Symlink(filepath.Join("releases", "0"), filepath.Join(branch, "current"))
+	port, bm := startUploadServer(t, workspace, `{"__type__": "ReceiveFileTask", "IPLists": "127.0.0.1", "Release": true}`)
+	bm.AddBranch("test1", branch)
+	b, _ := bm.GetBranch("test1")
+	if _, err := sendFiles(t, local, port, `, "ManifestMin": 1`); err != nil {
+		t.Fatal(err)
+	}
+	release := filepath.Join(branch, "releases", strconv.Itoa(b.Version+1), "mode.txt")
+	if info, err := os.Stat(release); err != nil || info.Mode().Perm() != 0755 {
+		t.Fatalf("release mode err:%v,%v", info, err)
+	}
+	if info, _ := os.Stat(filepath.Join(branch, "current", "mode.txt")); info.Mode().Perm() != 0644 {
+		t.Fatalf("current release modified:%o", info.Mode().Perm())
+	}
+}
+
+//测试文件较少时不发送清单，逐个对比md5：内容一致的文件不上传，只有权限不一致时修改权限
+func TestSmallTreeUpload(t *testing.T) {
+	local, workspace := tempDir(t, "kite-local"), tempDir(t, "kite-ws")
+	writeFiles(t, local, map[string]string{"same.txt": "same", "mode.txt": "mode", "changed.txt": "new", "sub/new.txt": "new"}, 0644)
+	writeFiles(t, filepath.Join(workspace, "test1"), map[string]string{"same.txt": "same", "changed.txt": "old"}, 0644)
+	writeFiles(t, filepath.Join(workspace, "test1"), map[string]string{"mode.txt": "mode"}, 0600)
+	port, _ := startUploadServer(t, workspace, `{"__type__": "ReceiveFileTask", "IPLists": "127.0.0.1"}`)
+	before := map[string]os.FileInfo{}
+	for _, name := range []string{"same.txt", "mode.txt"} {
+		before[name], _ = os.Stat(filepath.Join(workspace, "test1", name))
+	}
+	out, err := sendFiles(t, local, port, `, "Parallel": 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "manifest:") {
+		t.Fatalf("manifest sent for a small tree:%s", out)
+	}
+	for name, content := range map[string]string{"same.txt": "same", "mode.txt": "mode", "changed.txt": "new", "sub/new.txt": "new"} {
+		if data, _ := ioutil.ReadFile(filepath.Join(workspace, "test1", name)); string(data) != content {
+			t.Fatalf("file:%s content err:%s", name, data)
+		}
+	}
+	for name, info := range before {
+		after, _ := os.Stat(filepath.Join(workspace, "test1", name))
+		if !os.SameFile(info, after) {
+			t.Fatalf("file:%s uploaded again", name)
+		}
+		if after.Mode().Perm() != 0644 {
+			t.Fatalf("file:%s mode err:%o", name, after.Mode().Perm())
+		}
+	}
+}
+
+//jsonMap 解析json对象
+func jsonMap(t *testing.T, data string) map[string]interface{} {
+	val := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(data), &val); err != nil {
+		t.Fatalf("json:%s err:%v", data, err)
+	}
+	return val
+}
+
+//测试镜像：删除服务器上本地不存在的文件，排除的文件与link文件不删除
+func TestMirrorUpload(t *testing.T) {
+	local, workspace := tempDir(t, "kite-local"), tempDir(t, "kite-ws")
+	writeFiles(t, local, map[string]string{"keep.txt": "keep", "sub/keep.txt": "keep"}, 0644)
+	branch := filepath.Join(workspace, "test1")
+	writeFiles(t, branch, map[string]string{"old.txt": "old", "sub/old.txt": "old", "empty/old.txt": "old", "vendor/lib.txt": "lib"}, 0644)
+	os.Symlink("keep.txt", filepath.Join(branch, "link"))
+	port, _ := startUploadServer(t, workspace, `{"__type__": "ReceiveFileTask", "IPLists": "127.0.0.1"}`)
+	out, err := sendFiles(t, local, port, `, "Mirror": true, "Exclude": "/vendor/"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"delete:test1/old.txt", "delete:test1/sub/old.txt", "delete:test1/empty/old.txt", "mirror finish: 3 files deleted"} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("mirror output miss:%s; output:%s", line, out)
+		}
+	}
+	for name, exists := range map[string]bool{"keep.txt": true, "sub/keep.txt": true, "vendor/lib.txt": true, "link": true,
+		"old.txt": false, "sub/old.txt": false, "empty": false} {
+		if _, err := os.Lstat(filepath.Join(branch, name)); (err == nil) != exists {
+			t.Fatalf("file:%s exists:%v", name, err == nil)
+		}
+	}
+}
+
+//测试长连接上传：多个连接连续发送普通文件、文件块与差异，服务端逐个确认
+func TestStreamUpload(t *testing.T) {
+	local, workspace := tempDir(t, "kite-local"), tempDir(t, "kite-ws")
+	big := strings.Repeat("0123456789abcdef", 4096) //64K，分块上传
+	files := map[string]string{"big.bin": big, "sub/big.bin": big[1:]}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("dir%d/small%d.txt", i%3, i)] = strings.Repeat("x", i)
+	}
+	writeFiles(t, local, files, 0644)
+	port, _ := startUploadServer(t, workspace, `{"__type__": "ReceiveFileTask", "IPLists": "127.0.0.1"}`)
+	opts := `, "ManifestMin": 1, "Parallel": 3, "ChunkThreshold": 10000, "ChunkSize": 4096, "DeltaMin": 10000`
+	check := func() {
+		for name, content := range files {
+			if data, err := ioutil.ReadFile(filepath.Join(workspace, "test1", name)); err != nil || string(data) != content {
+				t.Fatalf("file:%s err:%v", name, err)
+			}
+		}
+	}
+	out, err := sendFiles(t, local, port, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check()
+	if !strings.Contains(out, fmt.Sprintf("manifest: %d files, %d need upload", len(files), len(files))) {
+		t.Fatalf("first upload output err:%s", out)
+	}
+	if out, err = sendFiles(t, local, port, opts); err != nil || !strings.Contains(out, "0 need upload") {
+		t.Fatalf("unchanged files uploaded again:%s,%v", out, err)
+	}
+	//修改大文件的中间部分，只上传差异
+	files["big.bin"] = big[:30000] + "changed" + big[30007:]
+	writeFiles(t, local, map[string]string{"big.bin": files["big.bin"]}, 0644)
+	if out, err = sendFiles(t, local, port, opts); err != nil || !strings.Contains(out, "1 need upload") || !strings.Contains(out, "delta upload:") {
+		t.Fatalf("delta upload err:%s,%v", out, err)
+	}
+	check()
+}
+
+//测试上传失败时返回错误，不能因为取消而当作成功
+func TestUploadFailure(t *testing.T) {
+	local, workspace := tempDir(t, "kite-local"), tempDir(t, "kite-ws")
+	files := map[string]string{}
+	for i := 0; i < 10; i++ {
+		files[fmt.Sprintf("sub/file%d.txt", i)] = "data"
+	}
+	writeFiles(t, local, files, 0644)
+	port, _ := startUploadServer(t, workspace, `{"__type__": "ReceiveFileTask", "IPLists": "127.0.0.1", "MaxBranchSize": 20}`) //只能保存5个文件
+	for i := 0; i < 10; i++ {
+		if out, err := sendFiles(t, local, port, `, "Parallel": 3, "Retry": 0`); err == nil {
+			t.Fatalf("failed upload returns nil:%s", out)
+		}
+	}
+}
+
+//TestConcurrentQuota 一个文件正在保存(内容还没有发送完)时，另一个连接上传的文件计入它预留的空间
+func TestConcurrentQuota(t *testing.T) {
+	workspace := tempDir(t, "kite-ws")
+	port, _ := startUploadServer(t, workspace, `{"__type__": "ReceiveFileTask", "IPLists": "127.0.0.1", "MaxBranchSize": 150000}`)
+	local := tempDir(t, "kite-local")
+	writeFiles(t, local, map[string]string{"a.bin": strings.Repeat("x", 100000), "b.bin": strings.Repeat("y", 100000)}, 0644)
+
+	a := openStream(t, port)
+	fa := fileFrame(t, local, "a.bin", 1)
+	fa.WriteTo(a)
+	body, _ := ioutil.ReadFile(filepath.Join(local, "a.bin"))
+	a.Write(body[:50000]) //只发送一半，服务端停在保存a.bin
+	time.Sleep(100 * time.Millisecond)
+
+	b := openStream(t, port)
+	fb := fileFrame(t, local, "b.bin", 2)
+	fb.WriteTo(b)
+	fb.SendFile(b)
+	if ack := readAck(t, b); ack.Success {
+		t.Fatal("b.bin should exceed the quota reserved by a.bin")
+	}
+	a.Write(body[50000:])
+	if ack := readAck(t, a); !ack.Success {
+		t.Fatalf("a.bin:%s", ack.Content)
+	}
+	if size, _ := util.DirSize(filepath.Join(workspace, "test1")); size > 150000 {
+		t.Fatalf("branch size:%d over quota", size)
+	}
+}
+
+//openStream 建立分支test1的长连接上传
+func openStream(t *testing.T, port string) net.Conn {
+	conn, err := net.Dial("tcp", "127.0.0.1:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	msg := message.NewCmdMessage("upload", "test1")
+	msg.Params = url.Values{"op": {"stream"}}
+	msg.WriteTo(conn)
+	return conn
+}
+
+//fileFrame 长连接中上传本地目录下的一个文件
+func fileFrame(t *testing.T, local, name string, seq int) *message.FileMessage {
+	msg, err := message.NewFileMessage(filepath.Join(local, name), local, "/", "test1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { msg.Close() })
+	msg.Seq = seq
+	return msg
+}
+
+//readAck 读取长连接中的确认消息
+func readAck(t *testing.T, conn net.Conn) *message.Message {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	for {
+		msg, err := message.ParseMsg(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == message.AckMessage {
+			return msg
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package util
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+const (
+	//minBlockSize 最小的文件块大小
+	minBlockSize = 2 << 10
+	//maxBlockSize 最大的文件块大小
+	maxBlockSize = 64 << 10
+
+	deltaCopy    = byte('C') //复制旧文件的块：C 块序号 块数量
+	deltaLiteral = byte('L') //新的数据：L 长度 数据
+	deltaEnd     = byte('E') //结束
+)
+
+//BlockSignature 文件块的签名：弱校验用于滚动查找，强校验用于确认
+type BlockSignature struct {
+	Weak   uint32
+	Strong [md5.Size]byte
+}
+
+//DeltaBlockSize 根据文件大小选择文件块大小
+func DeltaBlockSize(size int64) int {
+	block := int(math.Sqrt(float64(size)))
+	if block < minBlockSize {
+		return minBlockSize
+	}
+	if block > maxBlockSize {
+		return maxBlockSize
+	}
+	return block
+}
+
+//Signatures 计算文件所有完整块的签名；最后不足一块的数据不计算
+func Signatures(r io.Reader, blockSize int) ([]BlockSignature, error) {
+	sigs := []BlockSignature{}
+	buf := make([]byte, blockSize)
+	for {
+		_, err := io.ReadFull(r, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sigs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, BlockSignature{Weak: weakSum(buf), Strong: md5.Sum(buf)})
+	}
+}
+
+//EncodeSignatures 将签名编码为字节
+func EncodeSignatures(sigs []BlockSignature) []byte {
+	size := 4 + md5.Size
+	data := make([]byte, len(sigs)*size)
+	for i, sig := range sigs {
+		binary.BigEndian.PutUint32(data[i*size:], sig.Weak)
+		copy(data[i*size+4:], sig.Strong[:])
+	}
+	return data
+}
+
+//DecodeSignatures 解码签名
+func DecodeSignatures(data []byte) ([]BlockSignature, error) {
+	size := 4 + md5.Size
+	if len(data)%size != 0 {
+		return nil, fmt.Errorf("signature length err:%d", len(data))
+	}
+	sigs := make([]BlockSignature, 0, len(data)/size)
+	for i := 0; i < len(data); i += size {
+		sig := BlockSignature{Weak: binary.BigEndian.Uint32(data[i:])}
+		copy(sig.Strong[:], data[i+4:i+size])
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+//Delta 对比新文件与旧文件的签名，写入差异：旧文件中存在的块只写入块序号，其他的写入原始数据
+func Delta(r io.Reader, sigs []BlockSignature, blockSize int, w io.Writer) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	table := make(map[uint32][]int, len(sigs))
+	for i, sig := range sigs {
+		table[sig.Weak] = append(table[sig.Weak], i)
+	}
+	d := &deltaWriter{w: bufio.NewWriter(w), start: -1}
+	literal, i := 0, 0
+	var a, b uint32
+	if len(data) >= blockSize {
+		a, b = rollSum(data[:blockSize])
+	}
+	for len(table) > 0 && i+blockSize <= len(data) {
+		if index, ok := matchBlock(table, sigs, a|b<<16, data[i:i+blockSize]); ok {
+			d.literal(data[literal:i])
+			d.copy(index)
+			i += blockSize
+			literal = i
+			if i+blockSize <= len(data) {
+				a, b = rollSum(data[i : i+blockSize])
+			}
+			continue
+		}
+		if i+blockSize < len(data) { //向后滚动一个字节
+			out, in := uint32(data[i]), uint32(data[i+blockSize])
+			a = (a - out + in) & 0xffff
+			b = (b - uint32(blockSize)*out + a) & 0xffff
+		}
+		i++
+	}
+	d.literal(data[literal:])
+	return d.end()
+}
+
+//Patch 根据旧文件与差异生成新文件
+func Patch(base io.ReaderAt, blockSize int, delta io.Reader, w io.Writer) error {
+	r := bufio.NewReader(delta)
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case deltaEnd:
+			return nil
+		case deltaCopy:
+			index, err := binary.ReadUvarint(r)
+			if err != nil {
+				return err
+			}
+			count, err := binary.ReadUvarint(r)
+			if err != nil {
+				return err
+			}
+			length := int64(count) * int64(blockSize)
+			n, err := io.Copy(w, io.NewSectionReader(base, int64(index)*int64(blockSize), length))
+			if err != nil {
+				return err
+			}
+			if n != length {
+				return fmt.Errorf("delta block out of range:%d", index)
+			}
+		case deltaLiteral:
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return err
+			}
+			if _, err = io.CopyN(w, r, int64(length)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("delta op err:%c", op)
+		}
+	}
+}
+
+//matchBlock 查找与数据一致的块
+func matchBlock(table map[uint32][]int, sigs []BlockSignature, weak uint32, block []byte) (int, bool) {
+	indexes, ok := table[weak]
+	if !ok {
+		return 0, false
+	}
+	strong := md5.Sum(block)
+	for _, index := range indexes {
+		if sigs[index].Strong == strong {
+			return index, true
+		}
+	}
+	return 0, false
+}
+
+//weakSum 计算块的弱校验
+func weakSum(block []byte) uint32 {
+	a, b := rollSum(block)
+	return a | b<<16
+}
+
+//rollSum 计算滚动校验的两部分
+func rollSum(block []byte) (uint32, uint32) {
+	var a, b uint32
+	for i, c := range block {
+		a += uint32(c)
+		b += uint32(len(block)-i) * uint32(c)
+	}
+	return a & 0xffff, b & 0xffff
+}
+
+//deltaWriter 写入差异，连续的块合并为一个复制操作
+type deltaWriter struct {
+	w     *bufio.Writer
+	start int //连续块的起始序号，-1表示没有
+	count int //连续块的数量
+	err   error
+}
+
+//copy 复制旧文件的一个块
+func (d *deltaWriter) copy(index int) {
+	if d.start >= 0 && d.start+d.count == index {
+		d.count++
+		return
+	}
+	d.flush()
+	d.start, d.count = index, 1
+}
+
+//literal 写入新的数据
+func (d *deltaWriter) literal(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	d.flush()
+	d.head(deltaLiteral, uint64(len(data)))
+	d.write(data)
+}
+
+//flush 写入连续的块
+func (d *deltaWriter) flush() {
+	if d.start < 0 {
+		return
+	}
+	d.head(deltaCopy, uint64(d.start), uint64(d.count))
+	d.start, d.count = -1, 0
+}
+
+//head 写入操作类型与参数
+func (d *deltaWriter) head(op byte, args ...uint64) {
+	buf := make([]byte, 1+len(args)*binary.MaxVarintLen64)
+	buf[0] = op
+	n := 1
+	for _, arg := range args {
+		n += binary.PutUvarint(buf[n:], arg)
+	}
+	d.write(buf[:n])
+}
+
+//write 写入数据，记录第一个错误
+func (d *deltaWriter) write(data []byte) {
+	if d.err == nil {
+		_, d.err = d.w.Write(data)
+	}
+}
+
+//end 写入结束标记
+func (d *deltaWriter) end() error {
+	d.flush()
+	d.write([]byte{deltaEnd})
+	if d.err != nil {
+		return d.err
+	}
+	return d.w.Flush()
+}
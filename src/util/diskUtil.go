@@ -0,0 +1,38 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+//DirSize 目录下所有文件的大小之和；目录不存在时返回0
+func DirSize(root string) (int64, error) {
+	var size int64
+	err := filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if f.Mode().IsRegular() {
+			size += f.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+//FormatSize 格式化字节数，例如1.5GB
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit && size > -unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, i := float64(size)/unit, 0
+	for ; (value >= unit || value <= -unit) && i < 4; i++ {
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f%cB", value, "KMGTP"[i])
+}
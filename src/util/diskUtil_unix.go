@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+import "syscall"
+
+//DiskFree 路径所在磁盘的可用空间(单位：字节)
+func DiskFree(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,23 @@
+package util
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+//getDiskFreeSpaceEx kernel32的GetDiskFreeSpaceExW
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+//DiskFree 路径所在磁盘的可用空间(单位：字节)
+func DiskFree(path string) (int64, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free int64
+	ok, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&free)), 0, 0)
+	if ok == 0 {
+		return 0, err
+	}
+	return free, nil
+}
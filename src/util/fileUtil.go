@@ -102,3 +102,108 @@ func IndexOf(list []string, sub string) int {
 	}
 	return -1
 }
+
+//WriteFileAtomic 原子地写入文件：先写入临时文件并fsync，再替换原文件；中途崩溃时原文件不会损坏
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil { //保证rename写入磁盘
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+//CopyMode 复制文件并设置权限之后替换原来的文件；文件是硬链接时不修改其他链接指向的文件
+func CopyMode(path string, mode os.FileMode) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := path + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, mode) //创建文件时的权限受umask影响
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+//LinkTree 使用硬链接复制目录：先复制到临时目录再改名，中途失败时dst不存在；符号链接复制链接本身
+func LinkTree(src, dst string) error {
+	tmp := dst + ".tmp"
+	os.RemoveAll(tmp) //上次失败留下的临时目录
+	err := filepath.Walk(src, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(tmp, rel)
+		switch {
+		case f.IsDir():
+			return os.MkdirAll(target, f.Mode().Perm())
+		case f.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return os.Link(path, target)
+		}
+	})
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+	}
+	return err
+}
+
+//SwitchLink 原子地将符号链接指向target：先创建临时链接，再替换原来的链接
+func SwitchLink(target, link string) error {
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
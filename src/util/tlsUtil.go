@@ -0,0 +1,86 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+//NewServerTLSConfig 创建服务端的tls配置
+//clientCAFile 不为空时，要求客户端提供由该CA签发的证书(双向认证)
+func NewServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server cert fail:%v", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if len(clientCAFile) > 0 {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+//NewClientTLSConfig 创建客户端的tls配置
+//caFile 为空时使用系统的根证书; certFile、keyFile 不为空时向服务端提供客户端证书
+func NewClientTLSConfig(caFile, serverName, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if len(caFile) > 0 {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client cert fail:%v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+//Listen 监听端口；cfg不为空时使用tls
+func Listen(addr string, cfg *tls.Config) (net.Listener, error) {
+	if cfg == nil {
+		return net.Listen("tcp", addr)
+	}
+	return tls.Listen("tcp", addr, cfg)
+}
+
+//DialTimeout 建立连接；cfg不为空时使用tls；timeout为0表示不超时
+func DialTimeout(addr string, timeout time.Duration, cfg *tls.Config) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	if cfg == nil {
+		return dialer.Dial("tcp", addr)
+	}
+	return tls.DialWithDialer(dialer, "tcp", addr, cfg)
+}
+
+//loadCertPool 加载CA证书
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("load ca:%s fail:%v", caFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("ca:%s has no valid certificate", caFile)
+	}
+	return pool, nil
+}
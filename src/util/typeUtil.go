@@ -28,3 +28,8 @@ func RegisterType(elem interface{}) {
 	t := reflect.TypeOf(elem).Elem()
 	typeRegistry[t.Name()] = t
 }
+
+//TypeName 获取结构体指针注册的类型名称
+func TypeName(elem interface{}) string {
+	return reflect.TypeOf(elem).Elem().Name()
+}